@@ -0,0 +1,208 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"fadel-blog-services/configs/config"
+	"fadel-blog-services/configs/db"
+	"fadel-blog-services/configs/mailer"
+	"fadel-blog-services/configs/migrations"
+	"fadel-blog-services/configs/minio"
+	"fadel-blog-services/configs/storage"
+	"fadel-blog-services/configs/token"
+	"fadel-blog-services/controllers/blog"
+	"fadel-blog-services/controllers/health"
+	"fadel-blog-services/controllers/user"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// how long sending one mail may take
+const mailTimeout = 30 * time.Second
+
+// Deps are everything the http handlers need. Production wires them to
+// mongo and minio in New, tests can fill them with the in-memory stores.
+type Deps struct {
+	Config         *config.Config
+	Users          user.UserStore
+	RefreshTokens  user.RefreshTokenStore
+	Revocations    *user.RevocationList
+	Passwords      *user.PasswordPolicy
+	LoginAttempts  user.LoginAttemptStore
+	PasswordResets user.PasswordResetStore
+	Mailer         mailer.Mailer
+	TwoFactor      user.TwoFactorSettingsStore
+	AccessTokens   user.AccessTokenStore
+	OIDCLogins     user.OIDCLoginStore
+	Sessions       user.SessionStore
+	Blogs          blog.BlogStore
+	Objects        storage.ObjectStore
+	Keys           *token.Keyring
+	Checks         map[string]health.Check
+	// Logger is used for request logs, slog.Default() when nil
+	Logger *slog.Logger
+}
+
+type App struct {
+	Config *config.Config
+	Mongo  *mongo.Client
+	Mail   *mailer.Queue
+	Deps   Deps
+	Router *gin.Engine
+}
+
+// New connects to every backing service in order and builds the router.
+// Nothing is left half open when it fails.
+func New(ctx context.Context, cfg *config.Config) (*App, error) {
+	keys, err := NewKeyring(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("loading jwt keys: %w", err)
+	}
+
+	passwords, err := NewPasswordPolicy(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("loading password policy: %w", err)
+	}
+
+	if cfg.OIDCIssuer != "" && !user.Role(cfg.OIDCDefaultRole).Valid() {
+		return nil, fmt.Errorf("OIDC_DEFAULT_ROLE: %w", user.ErrInvalidRole)
+	}
+
+	client, err := db.Connect(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to mongodb: %w", err)
+	}
+	slog.Info("database connected")
+
+	database := client.Database(cfg.MongoDatabase)
+	if cfg.MigrateOnStartup {
+		if _, err := migrations.NewRunner(database, migrations.All).Up(ctx); err != nil {
+			client.Disconnect(context.Background())
+			return nil, fmt.Errorf("running migrations: %w", err)
+		}
+	}
+
+	m, err := newMailer(cfg)
+	if err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("setting up mailer: %w", err)
+	}
+
+	objects, err := newObjectStore(ctx, cfg)
+	if err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("setting up object storage: %w", err)
+	}
+
+	// requests only queue their mails, a slow smtp relay holds up nobody
+	mail := mailer.NewQueue(m, cfg.MailWorkers, cfg.MailQueueSize, mailTimeout)
+
+	deps := Deps{
+		Config:         cfg,
+		Users:          user.NewMongoStore(database),
+		RefreshTokens:  user.NewMongoRefreshTokenStore(database),
+		Revocations:    user.NewRevocationList(user.NewMongoRevocationStore(database), cfg.RevocationRefresh),
+		Passwords:      passwords,
+		LoginAttempts:  user.NewMongoLoginAttemptStore(database),
+		PasswordResets: user.NewMongoPasswordResetStore(database),
+		Mailer:         mail,
+		TwoFactor:      user.NewMongoTwoFactorSettingsStore(database),
+		AccessTokens:   user.NewMongoAccessTokenStore(database),
+		OIDCLogins:     user.NewMongoOIDCLoginStore(database),
+		Sessions:       user.NewMongoSessionStore(database),
+		Blogs:          blog.NewMongoStore(database),
+		Objects:        objects,
+		Keys:           keys,
+		Logger:         slog.Default(),
+		Checks: map[string]health.Check{
+			"mongodb": func(ctx context.Context) error {
+				return client.Ping(ctx, readpref.Primary())
+			},
+			"object_store": storage.NewWriteProbe(objects).Check,
+		},
+	}
+
+	return &App{
+		Config: cfg,
+		Mongo:  client,
+		Mail:   mail,
+		Deps:   deps,
+		Router: NewRouter(deps),
+	}, nil
+}
+
+// Close sends the queued mails and releases the connections opened by New
+func (a *App) Close(ctx context.Context) error {
+	a.Mail.Close()
+	return a.Mongo.Disconnect(ctx)
+}
+
+// NewKeyring builds the jwt keyring from JWT_KEYS/JWT_KEY_FILES/SECRET_KEY,
+// reading the pem files
+func NewKeyring(cfg *config.Config) (*token.Keyring, error) {
+	keys := make([]token.Key, len(cfg.JWTKeys))
+	for i, key := range cfg.JWTKeys {
+		if key.File == "" {
+			keys[i] = token.NewHMACKey(key.ID, []byte(key.Secret))
+			continue
+		}
+
+		data, err := os.ReadFile(key.File)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", key.ID, err)
+		}
+		if keys[i], err = token.ParsePEMKey(key.ID, data); err != nil {
+			return nil, fmt.Errorf("jwt key %q: %s: %w", key.ID, key.File, err)
+		}
+	}
+
+	return token.NewKeyring(cfg.JWTActiveKey, keys...)
+}
+
+// NewPasswordPolicy builds the password policy, reading PASSWORD_BREACH_LIST
+func NewPasswordPolicy(cfg *config.Config) (*user.PasswordPolicy, error) {
+	return user.NewPasswordPolicy(cfg.PasswordMinLength, cfg.BcryptCost, cfg.PasswordBreachList)
+}
+
+// newMailer picks the mail delivery configured by MAIL_DRIVER
+func newMailer(cfg *config.Config) (mailer.Mailer, error) {
+	if cfg.MailDriver == "smtp" {
+		return mailer.NewSMTPMailer(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom), nil
+	}
+
+	return mailer.NewFileMailer(cfg.MailFile)
+}
+
+// newObjectStore picks the media backend configured by STORAGE_DRIVER,
+// provisioning the bucket when it is minio
+func newObjectStore(ctx context.Context, cfg *config.Config) (storage.ObjectStore, error) {
+	if cfg.StorageDriver == "filesystem" {
+		return storage.NewFileStore(cfg.StorageDir)
+	}
+
+	client, err := minio.Connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := storage.NewMinioStore(client, cfg.MinioBucket)
+	if cfg.MinioProvision {
+		err := objects.Provision(ctx, storage.ProvisionOptions{
+			Region:         cfg.MinioRegion,
+			PublicPrefixes: cfg.MinioPublicPrefixes,
+			Versioning:     cfg.MinioVersioning,
+			NoncurrentDays: cfg.MinioNoncurrentDays,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return objects, nil
+}
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"fadel-blog-services/configs/config"
+	"fadel-blog-services/configs/helpers"
+	"fadel-blog-services/configs/logger"
+	"fadel-blog-services/configs/oidc"
+	"fadel-blog-services/configs/token"
+	"fadel-blog-services/controllers/blog"
+	"fadel-blog-services/controllers/health"
+	"fadel-blog-services/controllers/media"
+	"fadel-blog-services/controllers/user"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// NewRouter registers every route on a fresh gin engine
+func NewRouter(deps Deps) *gin.Engine {
+	cfg := deps.Config
+
+	l := deps.Logger
+	if l == nil {
+		l = slog.Default()
+	}
+
+	gin.SetMode(cfg.GinMode)
+	var router = gin.New()
+	// validated by config, an empty list trusts no proxy at all
+	router.SetTrustedProxies(cfg.TrustedProxies)
+	router.Use(logger.Middleware(l))
+	router.Use(gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		logger.From(c.Request.Context()).Error("panic recovered", "error", err, "stack", string(debug.Stack()))
+		helpers.SendFailed(c, http.StatusInternalServerError, "internal server error")
+	}))
+	// cookie sessions need credentialed requests, config makes sure the
+	// origins are listed then
+	router.Use(cors.New(cors.Config{
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Authorization", "Content-type", logger.RequestIDHeader, user.CSRFHeader, user.SessionModeHeader},
+		ExposeHeaders:    []string{logger.RequestIDHeader},
+		AllowAllOrigins:  cfg.AllowAllOrigins(),
+		AllowOrigins:     allowOrigins(cfg),
+		AllowCredentials: cfg.CookieSessions,
+	}))
+
+	throttle := user.NewLoginThrottle(deps.LoginAttempts, user.ThrottleOptions{
+		MaxUserFailures: cfg.LoginMaxFailures,
+		MaxIPFailures:   cfg.LoginMaxIPFailures,
+		Backoff:         cfg.LoginBackoff,
+		Lockout:         cfg.LoginLockout,
+		Window:          cfg.LoginFailureWindow,
+		AuditRetention:  cfg.LoginAuditRetention,
+	})
+	// the current password of /password/change is guessed like a login,
+	// per user id instead of username
+	passwordThrottle := user.NewLoginThrottle(deps.LoginAttempts, user.ThrottleOptions{
+		KeyPrefix:       "password:",
+		MaxUserFailures: cfg.LoginMaxFailures,
+		MaxIPFailures:   cfg.LoginMaxIPFailures,
+		Backoff:         cfg.LoginBackoff,
+		Lockout:         cfg.LoginLockout,
+		Window:          cfg.LoginFailureWindow,
+		AuditRetention:  cfg.LoginAuditRetention,
+	})
+	// reset requests aren't guesses, they only get a cap without backoff
+	resetThrottle := user.NewLoginThrottle(deps.LoginAttempts, user.ThrottleOptions{
+		KeyPrefix:       "reset:",
+		MaxUserFailures: cfg.PasswordResetMaxPerEmail,
+		MaxIPFailures:   cfg.PasswordResetMaxPerIP,
+		Lockout:         cfg.LoginLockout,
+		Window:          cfg.LoginFailureWindow,
+		AuditRetention:  cfg.LoginAuditRetention,
+	})
+
+	userCtl := &user.Controller{
+		Users:            deps.Users,
+		RefreshTokens:    deps.RefreshTokens,
+		Objects:          deps.Objects,
+		Passwords:        deps.Passwords,
+		Throttle:         throttle,
+		PasswordThrottle: passwordThrottle,
+		Revocations:      deps.Revocations,
+		Tokens:           token.NewIssuer(deps.Keys, cfg.JWTIssuer, cfg.JWTAudience, cfg.AccessTokenTTL, cfg.JWTLeeway),
+		RefreshTTL:       cfg.RefreshTokenTTL,
+		Cookies: user.CookieOptions{
+			Enabled:  cfg.CookieSessions,
+			Domain:   cfg.CookieDomain,
+			Secure:   cfg.CookieSecure,
+			SameSite: sameSite(cfg.CookieSameSite),
+		},
+
+		PasswordResets: deps.PasswordResets,
+		ResetThrottle:  resetThrottle,
+		Mailer:         deps.Mailer,
+		ResetURL:       cfg.PasswordResetURL,
+		ResetTTL:       cfg.PasswordResetTTL,
+
+		TwoFactorSettings: deps.TwoFactor,
+		TOTPIssuer:        cfg.TOTPIssuer,
+		ChallengeTTL:      cfg.TwoFactorChallengeTTL,
+
+		AccessTokens:      deps.AccessTokens,
+		AccessTokenMaxTTL: cfg.PersonalTokenMaxTTL,
+
+		Sessions:              deps.Sessions,
+		LoginHistoryRetention: cfg.LoginHistoryRetention,
+
+		OIDCLogins:        deps.OIDCLogins,
+		OIDCLoginTTL:      cfg.OIDCLoginTTL,
+		OIDCDefaultRole:   user.Role(cfg.OIDCDefaultRole),
+		OIDCAutoProvision: cfg.OIDCAutoProvision,
+		OIDCLinkByEmail:   cfg.OIDCLinkByEmail,
+	}
+	if cfg.OIDCIssuer != "" {
+		userCtl.OIDC = oidc.NewProvider(cfg.OIDCIssuer, cfg.OIDCClientID, cfg.OIDCClientSecret, cfg.OIDCRedirectURL, cfg.OIDCScopes)
+	}
+	blogCtl := blog.NewController(deps.Blogs, deps.Users, deps.Objects)
+	mediaCtl := media.NewController(deps.Objects)
+	healthCtl := health.NewController(deps.Checks)
+
+	// Health
+	router.GET("/healthz", healthCtl.Liveness)
+	router.GET("/readyz", healthCtl.Readiness)
+
+	// User
+	router.GET("/.well-known/jwks.json", userCtl.GetJWKS)
+	router.POST("/login", userCtl.Login)
+	router.POST("/token/refresh", userCtl.RefreshToken)
+	router.POST("/logout", userCtl.Auth, userCtl.Require(user.PermAccount), userCtl.Logout)
+	router.POST("/login/2fa", userCtl.LoginTwoFactor)
+	router.POST("/login/2fa/setup", userCtl.LoginTwoFactorSetup)
+	router.POST("/login/2fa/confirm", userCtl.LoginTwoFactorConfirm)
+	router.POST("/2fa/setup", userCtl.Auth, userCtl.Require(user.PermAccount), userCtl.SetupTwoFactor)
+	router.POST("/2fa/confirm", userCtl.Auth, userCtl.Require(user.PermAccount), userCtl.ConfirmTwoFactor)
+	router.POST("/2fa/disable", userCtl.Auth, userCtl.Require(user.PermAccount), userCtl.DisableTwoFactor)
+	if userCtl.OIDC != nil {
+		router.GET("/oidc/login", userCtl.OIDCLoginStart)
+		router.POST("/oidc/callback", userCtl.OIDCCallback)
+	}
+	router.POST("/password/forgot", userCtl.ForgotPassword)
+	router.POST("/password/reset", userCtl.ResetPassword)
+	router.POST("/password/change", userCtl.Auth, userCtl.Require(user.PermAccount), userCtl.ChangePassword)
+	router.GET("/me/tokens", userCtl.Auth, userCtl.Require(user.PermAccount), userCtl.GetAccessTokens)
+	router.POST("/me/tokens", userCtl.Auth, userCtl.Require(user.PermAccount), userCtl.CreateAccessToken)
+	router.DELETE("/me/tokens/:id", userCtl.Auth, userCtl.Require(user.PermAccount), userCtl.DeleteAccessToken)
+	router.GET("/me/sessions", userCtl.Auth, userCtl.Require(user.PermAccount), userCtl.GetSessions)
+	router.DELETE("/me/sessions/:id", userCtl.Auth, userCtl.Require(user.PermAccount), userCtl.DeleteSession)
+	router.GET("/users", userCtl.Auth, userCtl.Require(user.PermUsersRead), userCtl.GetUsers)
+	router.GET("/users/:id", userCtl.Auth, userCtl.Require(user.PermUsersRead), userCtl.GetUserById)
+	router.POST("/users", userCtl.Auth, userCtl.Require(user.PermUsersManage), userCtl.AddUser)
+	router.DELETE("/users/:id", userCtl.Auth, userCtl.Require(user.PermUsersManage), userCtl.DeleteUserById)
+	router.PATCH("/users/edit/:id", userCtl.Auth, userCtl.Require(user.PermUsersManage), userCtl.EditUserById)
+	router.PATCH("/users/updateprofile", userCtl.Auth, userCtl.Require(user.PermProfileWrite), userCtl.UpdateProfileImage)
+	router.POST("/users/:id/2fa/reset", userCtl.Auth, userCtl.Require(user.PermUsersManage), userCtl.ResetUserTwoFactor)
+	router.GET("/settings/2fa", userCtl.Auth, userCtl.Require(user.PermUsersManage), userCtl.GetTwoFactorSettings)
+	router.PUT("/settings/2fa", userCtl.Auth, userCtl.Require(user.PermUsersManage), userCtl.UpdateTwoFactorSettings)
+	router.POST("/users/:id/unlock", userCtl.Auth, userCtl.Require(user.PermUsersManage), userCtl.UnlockUser)
+	router.POST("/users/:id/revoke-sessions", userCtl.Auth, userCtl.Require(user.PermSessionsManage), userCtl.RevokeUserSessions)
+
+	// Blog
+	router.GET("/blog", blogCtl.GetBlogs)
+	router.GET("/blog/:slug", blogCtl.GetBlogBySlug)
+	router.POST("/blog", userCtl.Auth, userCtl.Require(user.PermBlogCreate), blogCtl.AddBlog)
+	router.PATCH("/blog/:id", userCtl.Auth, userCtl.Require(user.PermBlogEdit), blogCtl.EditBlogById)
+	router.DELETE("/blog/:id", userCtl.Auth, userCtl.Require(user.PermBlogDelete), blogCtl.DeleteBlogById)
+	router.PATCH("/blog/updatethumbnail/:id", userCtl.Auth, userCtl.Require(user.PermBlogEdit), blogCtl.UpdateBlogThumbnail)
+	router.PATCH("/blog/publish/:id", userCtl.Auth, userCtl.Require(user.PermBlogPublish), blogCtl.PublishBlogById)
+	router.PATCH("/blog/:id/owner", userCtl.Auth, userCtl.Require(user.PermBlogTransfer), blogCtl.TransferBlogOwnership)
+
+	// Media
+	router.GET("/media/*key", mediaCtl.GetObject)
+
+	return router
+}
+
+// sameSite maps COOKIE_SAMESITE, validated by config, to its cookie mode
+func sameSite(mode string) http.SameSite {
+	switch mode {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
+
+func allowOrigins(cfg *config.Config) []string {
+	if cfg.AllowAllOrigins() {
+		return nil
+	}
+	return cfg.CORSOrigins
+}
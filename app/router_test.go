@@ -0,0 +1,625 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"fadel-blog-services/configs/config"
+	"fadel-blog-services/configs/mailer"
+	"fadel-blog-services/configs/oidc/oidctest"
+	"fadel-blog-services/configs/storage"
+	"fadel-blog-services/controllers/blog"
+	"fadel-blog-services/controllers/user"
+)
+
+const testPassword = "correct-horse"
+
+// testApp is the router wired to the in-memory stores, with one account of
+// every role named after it
+type testApp struct {
+	t     *testing.T
+	deps  Deps
+	users map[user.Role]user.User
+}
+
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+	t.Setenv("DB_URL", "mongodb://localhost:27017")
+	t.Setenv("SECRET_KEY", "0123456789abcdef0123456789abcdef")
+	t.Setenv("STORAGE_DRIVER", "filesystem")
+	t.Setenv("GIN_MODE", "test")
+	t.Setenv("LOG_LEVEL", "error")
+
+	cfg, _, err := config.Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewKeyring(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the lowest bcrypt cost keeps the tests fast
+	passwords, err := user.NewPasswordPolicy(8, 4, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &testApp{
+		t: t,
+		deps: Deps{
+			Config:         cfg,
+			Users:          user.NewMemoryStore(),
+			RefreshTokens:  user.NewMemoryRefreshTokenStore(),
+			Revocations:    user.NewRevocationList(user.NewMemoryRevocationStore(), time.Second),
+			Passwords:      passwords,
+			LoginAttempts:  user.NewMemoryLoginAttemptStore(),
+			PasswordResets: user.NewMemoryPasswordResetStore(),
+			Mailer:         &mailer.WriterMailer{W: &strings.Builder{}},
+			TwoFactor:      user.NewMemoryTwoFactorSettingsStore(),
+			AccessTokens:   user.NewMemoryAccessTokenStore(),
+			OIDCLogins:     user.NewMemoryOIDCLoginStore(),
+			Sessions:       user.NewMemorySessionStore(),
+			Blogs:          blog.NewMemoryStore(),
+			Objects:        objects,
+			Keys:           keys,
+		},
+		users: map[user.Role]user.User{},
+	}
+
+	for _, role := range []user.Role{user.RoleAdmin, user.RoleEditor, user.RoleAuthor, user.RoleContributor} {
+		u, err := user.CreateUser(context.Background(), a.deps.Users, passwords, user.User{
+			Username: string(role),
+			Email:    string(role) + "@example.com",
+			Password: testPassword,
+			Role:     role,
+		}, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.users[role] = u
+	}
+
+	return a
+}
+
+// serve sends a request through a router built from the current deps and
+// config, so tests can change either first
+func (a *testApp) serve(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	NewRouter(a.deps).ServeHTTP(w, req)
+	return w
+}
+
+// do sends a json request, bearer is sent as the Authorization header
+func (a *testApp) do(method, path, body, bearer string) (int, map[string]any) {
+	a.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	w := a.serve(req)
+	var res map[string]any
+	json.Unmarshal(w.Body.Bytes(), &res)
+	return w.Code, res
+}
+
+// login returns the data of a password login of role's account
+func (a *testApp) login(role user.Role) map[string]any {
+	a.t.Helper()
+	code, res := a.do(http.MethodPost, "/login", `{"username":"`+string(role)+`","password":"`+testPassword+`"}`, "")
+	if code != http.StatusOK || res["status"] != "success" {
+		a.t.Fatalf("login as %s: %d %v", role, code, res)
+	}
+	return res["data"].(map[string]any)
+}
+
+func (a *testApp) token(role user.Role) string {
+	return a.login(role)["token"].(string)
+}
+
+func TestLoginHandler(t *testing.T) {
+	// the failures below would otherwise keep the client ip waiting
+	t.Setenv("LOGIN_BACKOFF", "1ns")
+	a := newTestApp(t)
+	if err := user.SetDisabled(context.Background(), a.deps.Users, a.users[user.RoleAuthor].UserId, true, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantCode   int
+		wantStatus string
+	}{
+		{"right password", `{"username":"admin","password":"correct-horse"}`, http.StatusOK, "success"},
+		{"wrong password", `{"username":"editor","password":"wrong-horse"}`, http.StatusOK, "failed"},
+		{"unknown user", `{"username":"nobody","password":"correct-horse"}`, http.StatusOK, "failed"},
+		{"disabled account", `{"username":"author","password":"correct-horse"}`, http.StatusForbidden, "failed"},
+		{"missing password", `{"username":"admin"}`, http.StatusBadRequest, "failed"},
+		{"not json", `username=admin`, http.StatusBadRequest, "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, res := a.do(http.MethodPost, "/login", tt.body, "")
+			if code != tt.wantCode || res["status"] != tt.wantStatus {
+				t.Fatalf("got %d %v, want %d %s", code, res, tt.wantCode, tt.wantStatus)
+			}
+			if tt.wantStatus == "success" {
+				data := res["data"].(map[string]any)
+				if data["token"] == nil || data["refresh_token"] == nil {
+					t.Fatalf("no tokens in %v", data)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthTokens(t *testing.T) {
+	a := newTestApp(t)
+	valid := a.token(user.RoleAdmin)
+	loggedOut := a.token(user.RoleAdmin)
+	if code, _ := a.do(http.MethodPost, "/logout", "", loggedOut); code != http.StatusOK {
+		t.Fatalf("logout: %d", code)
+	}
+
+	tests := []struct {
+		name     string
+		bearer   string
+		wantCode int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"garbage", "not-a-jwt", http.StatusUnauthorized},
+		{"tampered", valid[:len(valid)-2] + "xx", http.StatusUnauthorized},
+		{"logged out", loggedOut, http.StatusUnauthorized},
+		{"valid", valid, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := a.do(http.MethodGet, "/users", "", tt.bearer); code != tt.wantCode {
+				t.Fatalf("got %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRoutePermissions(t *testing.T) {
+	a := newTestApp(t)
+	tokens := map[user.Role]string{}
+	for role := range a.users {
+		tokens[role] = a.token(role)
+	}
+	target := a.users[user.RoleContributor].UserId
+
+	// the permission checks run before the handlers, so requests for
+	// missing blogs tell allowed (404) from forbidden (403)
+	tests := []struct {
+		method, path, body string
+		allowed            []user.Role
+		allowedCode        int
+	}{
+		{http.MethodGet, "/users", "", []user.Role{user.RoleAdmin, user.RoleEditor}, http.StatusOK},
+		{http.MethodGet, "/users/" + target, "", []user.Role{user.RoleAdmin, user.RoleEditor}, http.StatusOK},
+		{http.MethodPatch, "/users/edit/" + target, `{"full_name":"Someone"}`, []user.Role{user.RoleAdmin}, http.StatusCreated},
+		{http.MethodGet, "/settings/2fa", "", []user.Role{user.RoleAdmin}, http.StatusOK},
+		{http.MethodPatch, "/blog/missing", `{"title":"x"}`, []user.Role{user.RoleAdmin, user.RoleEditor, user.RoleAuthor, user.RoleContributor}, http.StatusNotFound},
+		{http.MethodDelete, "/blog/missing", "", []user.Role{user.RoleAdmin, user.RoleEditor, user.RoleAuthor}, http.StatusNotFound},
+		{http.MethodPatch, "/blog/publish/missing", "", []user.Role{user.RoleAdmin, user.RoleEditor, user.RoleAuthor}, http.StatusNotFound},
+		{http.MethodPatch, "/blog/missing/owner", `{"author_id":"` + target + `"}`, []user.Role{user.RoleAdmin, user.RoleEditor}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		for role, token := range tokens {
+			t.Run(tt.method+" "+tt.path+" as "+string(role), func(t *testing.T) {
+				want := http.StatusForbidden
+				for _, allowed := range tt.allowed {
+					if allowed == role {
+						want = tt.allowedCode
+					}
+				}
+				if code, res := a.do(tt.method, tt.path, tt.body, token); code != want {
+					t.Fatalf("got %d %v, want %d", code, res, want)
+				}
+			})
+		}
+	}
+}
+
+func TestBlogOwnershipRules(t *testing.T) {
+	a := newTestApp(t)
+	author := a.users[user.RoleAuthor]
+	err := a.deps.Blogs.Insert(context.Background(), blog.Blog{
+		BlogId:    "b1",
+		Title:     "First",
+		Slug:      "first",
+		AuthorId:  author.UserId,
+		CreatedBy: author.UserId,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		role     user.Role
+		wantCode int
+	}{
+		{"owner", user.RoleAuthor, http.StatusOK},
+		{"other contributor", user.RoleContributor, http.StatusForbidden},
+		{"editor edits any", user.RoleEditor, http.StatusOK},
+		{"admin edits any", user.RoleAdmin, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, res := a.do(http.MethodPatch, "/blog/b1", `{"title":"Edited by `+string(tt.role)+`"}`, a.token(tt.role))
+			if code != tt.wantCode {
+				t.Fatalf("got %d %v, want %d", code, res, tt.wantCode)
+			}
+		})
+	}
+
+	// an edit never moves the post to someone else
+	body := `{"title":"Mine now","author_id":"` + a.users[user.RoleContributor].UserId + `","published":"true"}`
+	if code, _ := a.do(http.MethodPatch, "/blog/b1", body, a.token(user.RoleAuthor)); code != http.StatusOK {
+		t.Fatalf("edit: %d", code)
+	}
+	b, err := a.deps.Blogs.FindById(context.Background(), "b1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.AuthorId != author.UserId || b.Published != "" || b.Slug != "mine-now" {
+		t.Fatalf("edit changed more than the title: %+v", b)
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	a := newTestApp(t)
+	first := a.login(user.RoleAdmin)["refresh_token"].(string)
+
+	refresh := func(token string) (int, string) {
+		code, res := a.do(http.MethodPost, "/token/refresh", `{"refresh_token":"`+token+`"}`, "")
+		if code != http.StatusOK {
+			return code, ""
+		}
+		return code, res["data"].(map[string]any)["refresh_token"].(string)
+	}
+
+	code, second := refresh(first)
+	if code != http.StatusOK || second == "" || second == first {
+		t.Fatalf("rotation: %d %q", code, second)
+	}
+
+	steps := []struct {
+		name     string
+		token    string
+		wantCode int
+	}{
+		// reusing a spent token revokes the whole family
+		{"reused token", first, http.StatusUnauthorized},
+		{"rest of the family", second, http.StatusUnauthorized},
+		{"unknown token", "fbs_nope", http.StatusUnauthorized},
+	}
+	for _, step := range steps {
+		if code, _ := refresh(step.token); code != step.wantCode {
+			t.Fatalf("%s: got %d, want %d", step.name, code, step.wantCode)
+		}
+	}
+}
+
+func TestCSRFCookieSessions(t *testing.T) {
+	t.Setenv("COOKIE_SESSIONS", "true")
+	t.Setenv("CORS_ORIGINS", "https://admin.example.com")
+	a := newTestApp(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username":"author","password":"correct-horse"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(user.SessionModeHeader, "cookie")
+	w := a.serve(req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("cookie login: %d %s", w.Code, w.Body)
+	}
+	var res map[string]any
+	json.Unmarshal(w.Body.Bytes(), &res)
+	data := res["data"].(map[string]any)
+	if data["token"] != nil || data["refresh_token"] != nil {
+		t.Fatalf("tokens in the body of a cookie login: %v", data)
+	}
+	csrf := data["csrf_token"].(string)
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+		if cookie.HttpOnly != (cookie.Name != user.CSRFCookie) {
+			t.Fatalf("cookie %s HttpOnly=%v", cookie.Name, cookie.HttpOnly)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		csrf     string
+		wantCode int
+	}{
+		{"safe method without token", http.MethodGet, "", http.StatusOK},
+		{"unsafe method without token", http.MethodPatch, "", http.StatusForbidden},
+		{"wrong token", http.MethodPatch, "nope", http.StatusForbidden},
+		{"right token", http.MethodPatch, csrf, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/me/sessions"
+			if tt.method != http.MethodGet {
+				path = "/blog/missing"
+			}
+			req := httptest.NewRequest(tt.method, path, strings.NewReader(`{"title":"x"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.AddCookie(cookies[user.SessionCookie])
+			req.AddCookie(cookies[user.CSRFCookie])
+			if tt.csrf != "" {
+				req.Header.Set(user.CSRFHeader, tt.csrf)
+			}
+			if w := a.serve(req); w.Code != tt.wantCode {
+				t.Fatalf("got %d %s, want %d", w.Code, w.Body, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestMediaKeys(t *testing.T) {
+	a := newTestApp(t)
+	ctx := context.Background()
+	objects := map[string]string{
+		"private/secret.txt": "secret",
+		"blog/a.png":         "png",
+		"blog/page.svg":      "<svg/>",
+	}
+	for key, content := range objects {
+		if _, err := a.deps.Objects.Put(ctx, key, strings.NewReader(content), int64(len(content)), "application/octet-stream"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path            string
+		wantCode        int
+		wantContentType string
+	}{
+		{"/media/blog/a.png", http.StatusOK, "image/png"},
+		{"/media/blog/page.svg", http.StatusOK, "application/octet-stream"},
+		{"/media/private/secret.txt", http.StatusNotFound, ""},
+		{"/media/blog/../private/secret.txt", http.StatusNotFound, ""},
+		{"/media/blog/%2e%2e/private/secret.txt", http.StatusNotFound, ""},
+		{"/media/blog//a.png", http.StatusNotFound, ""},
+		{"/media/blog/missing.png", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := a.serve(httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("got %d, want %d", w.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			header := w.Header()
+			if got := header.Get("Content-Type"); got != tt.wantContentType {
+				t.Fatalf("Content-Type %q, want %q", got, tt.wantContentType)
+			}
+			if header.Get("X-Content-Type-Options") != "nosniff" || header.Get("Content-Security-Policy") != "sandbox" {
+				t.Fatalf("missing hardening headers: %v", header)
+			}
+		})
+	}
+}
+
+func TestLoginThrottleBurst(t *testing.T) {
+	t.Setenv("LOGIN_MAX_FAILURES", "3")
+	a := newTestApp(t)
+	router := NewRouter(a.deps)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	codes := map[int]int{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username":"author","password":"wrong-horse"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			mu.Lock()
+			codes[w.Code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// the first guess reserves the attempt, the rest wait out its backoff
+	if codes[http.StatusOK] != 1 || codes[http.StatusTooManyRequests] != 19 {
+		t.Fatalf("got %v", codes)
+	}
+}
+
+func TestDeleteUserRevokesTokens(t *testing.T) {
+	a := newTestApp(t)
+	admin := a.token(user.RoleAdmin)
+	session := a.login(user.RoleAuthor)
+	token := session["token"].(string)
+	refreshToken := session["refresh_token"].(string)
+
+	if code, res := a.do(http.MethodGet, "/me/sessions", "", token); code != http.StatusOK {
+		t.Fatalf("before delete: %d %v", code, res)
+	}
+	if code, res := a.do(http.MethodDelete, "/users/"+a.users[user.RoleAuthor].UserId, "", admin); code != http.StatusOK {
+		t.Fatalf("delete: %d %v", code, res)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		bearer string
+	}{
+		{"access token", http.MethodGet, "/me/sessions", "", token},
+		{"refresh token", http.MethodPost, "/token/refresh", `{"refresh_token":"` + refreshToken + `"}`, ""},
+	}
+	for _, tt := range tests {
+		if code, res := a.do(tt.method, tt.path, tt.body, tt.bearer); code != http.StatusUnauthorized {
+			t.Errorf("%s after delete: %d %v, want 401", tt.name, code, res)
+		}
+	}
+}
+
+// auditRecorder keeps the failures written to the LoginAttemptStore
+type auditRecorder struct {
+	user.LoginAttemptStore
+	mu       sync.Mutex
+	failures []user.LoginFailure
+}
+
+func (r *auditRecorder) Audit(ctx context.Context, failure user.LoginFailure) error {
+	r.mu.Lock()
+	r.failures = append(r.failures, failure)
+	r.mu.Unlock()
+	return r.LoginAttemptStore.Audit(ctx, failure)
+}
+
+func TestChangePasswordThrottle(t *testing.T) {
+	t.Setenv("LOGIN_BACKOFF", "1ns")
+	t.Setenv("LOGIN_MAX_FAILURES", "3")
+	a := newTestApp(t)
+	audit := &auditRecorder{LoginAttemptStore: a.deps.LoginAttempts}
+	a.deps.LoginAttempts = audit
+	token := a.token(user.RoleAuthor)
+	userId := a.users[user.RoleAuthor].UserId
+
+	change := func(current string) int {
+		code, _ := a.do(http.MethodPost, "/password/change",
+			`{"current_password":"`+current+`","new_password":"staple-battery"}`, token)
+		return code
+	}
+
+	steps := []struct {
+		name     string
+		current  string
+		wantCode int
+	}{
+		{"first guess", "guess-1", http.StatusBadRequest},
+		{"second guess", "guess-2", http.StatusBadRequest},
+		{"third guess", "guess-3", http.StatusBadRequest},
+		// locked out, even with the right password
+		{"right password", testPassword, http.StatusTooManyRequests},
+	}
+	for _, step := range steps {
+		if code := change(step.current); code != step.wantCode {
+			t.Fatalf("%s: got %d, want %d", step.name, code, step.wantCode)
+		}
+	}
+
+	reasons := map[string]int{}
+	for _, failure := range audit.failures {
+		if failure.Username != userId {
+			t.Fatalf("failure recorded for %q, want the user id %q", failure.Username, userId)
+		}
+		reasons[failure.Reason]++
+	}
+	if reasons[user.ReasonWrongCurrentPassword] != 3 || reasons[user.ReasonThrottled] != 1 {
+		t.Fatalf("recorded reasons %v", reasons)
+	}
+
+	// the lockout is the password check's own, logging in still works
+	a.login(user.RoleAuthor)
+}
+
+func TestOIDCLinkByEmail(t *testing.T) {
+	issuer, err := oidctest.NewIssuer("blog", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer issuer.Close()
+	t.Setenv("OIDC_ISSUER", issuer.URL())
+	t.Setenv("OIDC_CLIENT_ID", "blog")
+	t.Setenv("OIDC_CLIENT_SECRET", "s3cret")
+	t.Setenv("OIDC_REDIRECT_URL", "http://localhost:3000/oidc/callback")
+	a := newTestApp(t)
+
+	oidcLogin := func(identity oidctest.Identity) (int, map[string]any) {
+		issuer.SetIdentity(identity)
+		code, res := a.do(http.MethodGet, "/oidc/login", "", "")
+		if code != http.StatusOK {
+			t.Fatalf("oidc login: %d %v", code, res)
+		}
+		data := res["data"].(map[string]any)
+		authCode, state, err := issuer.Authorize(data["authorization_url"].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a.do(http.MethodPost, "/oidc/callback", `{"code":"`+authCode+`","state":"`+state+`"}`, "")
+	}
+
+	tests := []struct {
+		name         string
+		linkByEmail  bool
+		role         user.Role
+		wantCode     int
+		wantUsername string // empty for a newly provisioned account
+	}{
+		{"off by default", false, user.RoleAuthor, http.StatusOK, ""},
+		{"contributor", true, user.RoleContributor, http.StatusOK, "contributor"},
+		{"author", true, user.RoleAuthor, http.StatusOK, "author"},
+		{"editor", true, user.RoleEditor, http.StatusForbidden, ""},
+		{"admin", true, user.RoleAdmin, http.StatusForbidden, ""},
+	}
+	if a.deps.Config.OIDCLinkByEmail {
+		t.Fatal("OIDC_LINK_BY_EMAIL is on by default")
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.deps.Config.OIDCLinkByEmail = tt.linkByEmail
+			code, res := oidcLogin(oidctest.Identity{
+				Subject:       fmt.Sprintf("subject-%d", i),
+				Email:         string(tt.role) + "@example.com",
+				EmailVerified: true,
+			})
+			if code != tt.wantCode {
+				t.Fatalf("got %d %v, want %d", code, res, tt.wantCode)
+			}
+			if code != http.StatusOK {
+				return
+			}
+
+			username := res["data"].(map[string]any)["username"]
+			if tt.wantUsername != "" && username != tt.wantUsername {
+				t.Fatalf("logged in as %v, want %s", username, tt.wantUsername)
+			}
+			if tt.wantUsername == "" && username == string(tt.role) {
+				t.Fatalf("identity was linked to %v", username)
+			}
+		})
+	}
+
+	// a refused identity stays unlinked
+	for _, role := range []user.Role{user.RoleEditor, user.RoleAdmin} {
+		u, err := a.deps.Users.FindById(context.Background(), a.users[role].UserId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.OIDCSubject != "" {
+			t.Fatalf("%s linked to %q", role, u.OIDCSubject)
+		}
+	}
+}
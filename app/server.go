@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Run serves http until ctx is cancelled (SIGINT/SIGTERM in main), then stops
+// accepting connections, lets in-flight requests finish for up to
+// SHUTDOWN_TIMEOUT and finally disconnects mongodb.
+func (a *App) Run(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              a.Config.ListenAddr,
+		Handler:           a.Router,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       a.Config.ReadTimeout,
+		WriteTimeout:      a.Config.WriteTimeout,
+		IdleTimeout:       a.Config.IdleTimeout,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "addr", srv.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		// the listener never came up (port in use, ...)
+		a.Close(context.Background())
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, waiting for in-flight requests", "timeout", a.Config.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.Config.ShutdownTimeout)
+	defer cancel()
+
+	shutdownErr := srv.Shutdown(shutdownCtx)
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) && shutdownErr == nil {
+		shutdownErr = err
+	}
+
+	// mongo gets its own deadline, a slow drain shouldn't leave the client open
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelClose()
+	if err := a.Close(closeCtx); err != nil && shutdownErr == nil {
+		shutdownErr = err
+	}
+
+	slog.Info("shutdown complete")
+	return shutdownErr
+}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"fadel-blog-services/configs/config"
+	"fadel-blog-services/controllers/blog"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func blogCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "reslug" {
+		return errUsage
+	}
+
+	fset := flag.NewFlagSet("blog reslug", flag.ContinueOnError)
+	dryRun := fset.Bool("dry-run", false, "only print the slugs that would change")
+	if err := fset.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+
+	return withDatabase(cfg, func(ctx context.Context, database *mongo.Database) error {
+		changes, err := blog.Reslug(ctx, blog.NewMongoStore(database), *dryRun, updatedBy)
+		for _, change := range changes {
+			fmt.Printf("%s: %s -> %s\n", change.BlogId, change.OldSlug, change.NewSlug)
+		}
+		if err != nil {
+			return err
+		}
+
+		if *dryRun {
+			fmt.Printf("%d slug(s) would change\n", len(changes))
+		} else {
+			fmt.Printf("%d slug(s) changed\n", len(changes))
+		}
+		return nil
+	})
+}
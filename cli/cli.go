@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"fadel-blog-services/app"
+	"fadel-blog-services/configs/config"
+	"fadel-blog-services/configs/db"
+	"fadel-blog-services/configs/logger"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const usage = `usage: fadel-blog-services [config flags] <command> [args]
+
+commands:
+  serve                                  run the http server (default)
+  user create -username U [-admin] ...   create an account, the way to bootstrap the first one
+  user reset-password -username U        set a new password
+  user disable -username U               block an account from logging in
+  user enable -username U                unblock an account
+  user set-role -username U -role R      change the role of an account
+  migrate up|down|status                 manage database migrations
+  blog reslug [-dry-run]                 regenerate every slug from its title
+
+run with -h to list the config flags, every one of them can also be set
+through the environment or the .env file`
+
+// updatedBy is recorded as updated_by for changes made from the cli
+const updatedBy = "cli"
+
+var errUsage = errors.New("invalid usage")
+
+// Run executes the command in args and returns the process exit code
+func Run(args []string) int {
+	cfg, rest, err := config.Load(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	l, err := logger.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	slog.SetDefault(l)
+
+	if len(rest) == 0 {
+		rest = []string{"serve"}
+	}
+
+	switch rest[0] {
+	case "serve":
+		err = serve(cfg)
+	case "user":
+		err = userCommand(cfg, rest[1:])
+	case "migrate":
+		err = migrateCommand(cfg, rest[1:])
+	case "blog":
+		err = blogCommand(cfg, rest[1:])
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return 0
+	default:
+		err = errUsage
+	}
+
+	if err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, usage)
+			return 2
+		}
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+func serve(cfg *config.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	application, err := app.New(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	return application.Run(ctx)
+}
+
+// withDatabase connects to mongodb for the duration of fn
+func withDatabase(cfg *config.Config, fn func(ctx context.Context, database *mongo.Database) error) error {
+	ctx := context.Background()
+
+	client, err := db.Connect(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("connecting to mongodb: %w", err)
+	}
+	defer client.Disconnect(ctx)
+
+	return fn(ctx, client.Database(cfg.MongoDatabase))
+}
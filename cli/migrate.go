@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"fadel-blog-services/configs/config"
+	"fadel-blog-services/configs/migrations"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func migrateCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	fset := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	steps := fset.Int("steps", 1, "how many migrations to revert")
+	if err := fset.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+
+	return withDatabase(cfg, func(ctx context.Context, database *mongo.Database) error {
+		runner := migrations.NewRunner(database, migrations.All)
+
+		switch args[0] {
+		case "up":
+			count, err := runner.Up(ctx)
+			fmt.Printf("%d migration(s) applied\n", count)
+			return err
+
+		case "down":
+			count, err := runner.Down(ctx, *steps)
+			fmt.Printf("%d migration(s) reverted\n", count)
+			return err
+
+		case "status":
+			statuses, err := runner.Status(ctx)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+			for _, status := range statuses {
+				appliedAt := "pending"
+				if status.AppliedAt != nil {
+					appliedAt = status.AppliedAt.Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+			}
+			return w.Flush()
+		}
+
+		return errUsage
+	})
+}
@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"fadel-blog-services/app"
+	"fadel-blog-services/configs/config"
+	"fadel-blog-services/configs/store"
+	"fadel-blog-services/controllers/user"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func userCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	fset := flag.NewFlagSet("user "+args[0], flag.ContinueOnError)
+	username := fset.String("username", "", "username of the account")
+
+	switch args[0] {
+	case "create":
+		fullname := fset.String("fullname", "", "full name")
+		phone := fset.String("phone", "", "phone number")
+		email := fset.String("email", "", "email address, needed for password reset by mail")
+		password := fset.String("password", "", "password, read from stdin when empty. Visible in shell history and ps, prefer stdin")
+		role := fset.String("role", string(user.DefaultRole), "admin, editor, author or contributor")
+		admin := fset.Bool("admin", false, "shorthand for -role admin")
+		if err := parseUserFlags(fset, args[1:], username); err != nil {
+			return err
+		}
+
+		pw, err := readPassword(*password)
+		if err != nil {
+			return err
+		}
+
+		if *admin {
+			*role = string(user.RoleAdmin)
+		}
+
+		passwords, err := app.NewPasswordPolicy(cfg)
+		if err != nil {
+			return err
+		}
+
+		return withDatabase(cfg, func(ctx context.Context, database *mongo.Database) error {
+			created, err := user.CreateUser(ctx, user.NewMongoStore(database), passwords, user.User{
+				Fullname:    *fullname,
+				Username:    *username,
+				Email:       *email,
+				Password:    pw,
+				PhoneNumber: *phone,
+				Role:        user.Role(*role),
+			}, updatedBy)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("user %s created with id %s and role %s\n", created.Username, created.UserId, created.Role)
+			return nil
+		})
+
+	case "reset-password":
+		password := fset.String("password", "", "new password, read from stdin when empty. Visible in shell history and ps, prefer stdin")
+		if err := parseUserFlags(fset, args[1:], username); err != nil {
+			return err
+		}
+
+		pw, err := readPassword(*password)
+		if err != nil {
+			return err
+		}
+
+		passwords, err := app.NewPasswordPolicy(cfg)
+		if err != nil {
+			return err
+		}
+
+		return withUser(cfg, *username, func(ctx context.Context, database *mongo.Database, users user.UserStore, u user.User) error {
+			if err := user.SetPassword(ctx, users, passwords, u.UserId, pw, updatedBy); err != nil {
+				return err
+			}
+
+			// whoever knew the old password must not stay logged in
+			if err := revokeSessions(ctx, cfg, database, u.UserId); err != nil {
+				return err
+			}
+
+			fmt.Printf("password of %s reset, sessions revoked\n", u.Username)
+			return nil
+		})
+
+	case "disable", "enable":
+		if err := parseUserFlags(fset, args[1:], username); err != nil {
+			return err
+		}
+
+		disabled := args[0] == "disable"
+		return withUser(cfg, *username, func(ctx context.Context, database *mongo.Database, users user.UserStore, u user.User) error {
+			if err := user.SetDisabled(ctx, users, u.UserId, disabled, updatedBy); err != nil {
+				return err
+			}
+
+			// a disabled account must not keep its open sessions either
+			if disabled {
+				if err := revokeSessions(ctx, cfg, database, u.UserId); err != nil {
+					return err
+				}
+			}
+
+			fmt.Printf("user %s %sd\n", u.Username, args[0])
+			return nil
+		})
+
+	case "set-role":
+		role := fset.String("role", "", "admin, editor, author or contributor")
+		if err := parseUserFlags(fset, args[1:], username); err != nil {
+			return err
+		}
+
+		return withUser(cfg, *username, func(ctx context.Context, database *mongo.Database, users user.UserStore, u user.User) error {
+			if err := user.SetRole(ctx, users, u.UserId, user.Role(*role), updatedBy); err != nil {
+				return err
+			}
+
+			// tokens carry the role, the old ones must not outlive it
+			if u.Role != user.Role(*role) {
+				if err := revokeSessions(ctx, cfg, database, u.UserId); err != nil {
+					return err
+				}
+			}
+
+			fmt.Printf("user %s now has role %s\n", u.Username, *role)
+			return nil
+		})
+	}
+
+	return errUsage
+}
+
+func parseUserFlags(fset *flag.FlagSet, args []string, username *string) error {
+	if err := fset.Parse(args); err != nil {
+		return errUsage
+	}
+	if *username == "" {
+		return errors.New("-username is required")
+	}
+	return nil
+}
+
+// revokeSessions ends every session of the user, like the http handlers do
+func revokeSessions(ctx context.Context, cfg *config.Config, database *mongo.Database, userId string) error {
+	revocations := user.NewRevocationList(user.NewMongoRevocationStore(database), cfg.RevocationRefresh)
+	return user.RevokeSessions(ctx, revocations, user.NewMongoRefreshTokenStore(database), user.NewMongoAccessTokenStore(database), user.NewMongoSessionStore(database), userId, cfg.AccessTokenTTL)
+}
+
+// withUser looks the account up by username before running fn
+func withUser(cfg *config.Config, username string, fn func(ctx context.Context, database *mongo.Database, users user.UserStore, u user.User) error) error {
+	return withDatabase(cfg, func(ctx context.Context, database *mongo.Database) error {
+		users := user.NewMongoStore(database)
+
+		u, err := users.FindByUsername(ctx, username)
+		if err == store.ErrNotFound {
+			return fmt.Errorf("user %s not found", username)
+		}
+		if err != nil {
+			return err
+		}
+
+		return fn(ctx, database, users, u)
+	})
+}
+
+// readPassword returns flagValue or the first line of stdin, so passwords
+// can be piped in instead of showing up in the shell history
+func readPassword(flagValue string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+
+	fmt.Fprint(os.Stderr, "password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading password: %w", err)
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+	return password, nil
+}
@@ -0,0 +1,799 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Config struct {
+	MongoURI      string
+	MongoDatabase string
+
+	MigrateOnStartup bool
+
+	StorageDriver string
+	StorageDir    string
+
+	MinioEndpoint    string
+	MinioAccessKeyID string
+	MinioSecretKey   string
+	MinioUseSSL      bool
+	MinioBucket      string
+	MinioRegion      string
+
+	MinioProvision      bool
+	MinioPublicPrefixes []string
+	MinioVersioning     string
+	MinioNoncurrentDays int
+
+	// JWTKeys verify tokens, JWTActiveKey names the one that signs new ones.
+	// A SECRET_KEY without JWT_KEYS becomes the key "default".
+	JWTKeys      []JWTKey
+	JWTActiveKey string
+	JWTSecret    string
+	JWTIssuer    string
+	JWTAudience  string
+	// JWTLeeway is the clock difference tolerated on exp, nbf and iat
+	JWTLeeway time.Duration
+
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// RevocationRefresh is how often the revocation list is reloaded, i.e.
+	// how long a logout on one replica may take to reach the others
+	RevocationRefresh time.Duration
+
+	PasswordMinLength  int
+	PasswordBreachList string
+	BcryptCost         int
+
+	LoginMaxFailures    int
+	LoginMaxIPFailures  int
+	LoginBackoff        time.Duration
+	LoginLockout        time.Duration
+	LoginFailureWindow  time.Duration
+	LoginAuditRetention time.Duration
+	// LoginHistoryRetention is how long ended sessions stay listed
+	LoginHistoryRetention time.Duration
+
+	// MailDriver is 'smtp' or 'file', the latter writes mails to MailFile
+	// ('-' for stdout) instead of sending them
+	MailDriver   string
+	MailFile     string
+	MailFrom     string
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	// MailWorkers send the mails waiting in a queue of MailQueueSize
+	MailWorkers   int
+	MailQueueSize int
+
+	// PasswordResetURL is the frontend page a reset link points to, the
+	// token is added as the "token" query parameter
+	PasswordResetURL string
+	PasswordResetTTL time.Duration
+	// PasswordResetMaxPerEmail and PasswordResetMaxPerIP are the reset
+	// requests within LoginFailureWindow after which an email or a client
+	// ip is turned away for LoginLockout
+	PasswordResetMaxPerEmail int
+	PasswordResetMaxPerIP    int
+
+	// TOTPIssuer is the name authenticator apps show next to the code
+	TOTPIssuer            string
+	TwoFactorChallengeTTL time.Duration
+
+	// PersonalTokenMaxTTL caps the lifetime of personal access tokens
+	PersonalTokenMaxTTL time.Duration
+
+	// OIDCIssuer enables login through an OpenID provider, empty disables it
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	// OIDCRedirectURL is the frontend page the provider sends the browser
+	// back to, it posts code and state on to /oidc/callback
+	OIDCRedirectURL   string
+	OIDCScopes        []string
+	OIDCLoginTTL      time.Duration
+	OIDCDefaultRole   string
+	OIDCAutoProvision bool
+	OIDCLinkByEmail   bool
+
+	ListenAddr  string
+	CORSOrigins []string
+	GinMode     string
+
+	// CookieSessions lets browsers log in with HttpOnly cookies instead of
+	// bearer tokens, CORS_ORIGINS then has to list the frontends
+	CookieSessions bool
+	CookieDomain   string
+	CookieSecure   bool
+	// CookieSameSite is 'strict', 'lax' or 'none'
+	CookieSameSite string
+	// TrustedProxies may set X-Forwarded-For, empty trusts nobody so the
+	// client ip used for login throttling can't be spoofed
+	TrustedProxies []string
+
+	LogLevel  string
+	LogFormat string
+
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+}
+
+// JWTKey is an HMAC Secret, or the File of an RSA or Ed25519 pem key
+type JWTKey struct {
+	ID     string
+	Secret string
+	File   string
+}
+
+// ValidationError lists every setting that is missing or invalid, so the
+// operator can fix all of them in one go instead of one per restart
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// HS256 secrets shorter than the hash output are easy to brute force
+const minSecretLength = 32
+
+type setting struct {
+	env   string
+	flag  string
+	def   string
+	usage string
+	apply func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{"DB_URL", "db-url", "", "mongodb connection string", func(c *Config, v string) error {
+		c.MongoURI = v
+		return nil
+	}},
+	{"DB_NAME", "db-name", "fadel-blog", "mongodb database name", func(c *Config, v string) error {
+		c.MongoDatabase = v
+		return nil
+	}},
+	{"MIGRATE_ON_STARTUP", "migrate-on-startup", "true", "apply pending database migrations before serving", func(c *Config, v string) (err error) {
+		c.MigrateOnStartup, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"STORAGE_DRIVER", "storage-driver", "minio", "object storage backend, 'minio' or 'filesystem'", func(c *Config, v string) error {
+		c.StorageDriver = v
+		return nil
+	}},
+	{"STORAGE_DIR", "storage-dir", "./data", "directory used by the filesystem storage backend", func(c *Config, v string) error {
+		c.StorageDir = v
+		return nil
+	}},
+	{"MINIO_ENDPOINT", "minio-endpoint", "", "minio host:port", func(c *Config, v string) error {
+		c.MinioEndpoint = v
+		return nil
+	}},
+	{"MINIO_ACCESS_KEY_ID", "minio-access-key-id", "", "minio access key id", func(c *Config, v string) error {
+		c.MinioAccessKeyID = v
+		return nil
+	}},
+	{"MINIO_ACCESS_KEY_PASS", "minio-access-key-pass", "", "minio secret access key", func(c *Config, v string) error {
+		c.MinioSecretKey = v
+		return nil
+	}},
+	{"MINIO_USE_SSL", "minio-use-ssl", "false", "connect to minio over https", func(c *Config, v string) (err error) {
+		c.MinioUseSSL, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"MINIO_BUCKET", "minio-bucket", "fadel-blog", "bucket holding uploaded media", func(c *Config, v string) error {
+		c.MinioBucket = v
+		return nil
+	}},
+	{"MINIO_REGION", "minio-region", "", "region used when the bucket has to be created", func(c *Config, v string) error {
+		c.MinioRegion = v
+		return nil
+	}},
+	{"MINIO_PROVISION", "minio-provision", "true", "create the bucket and apply its policy on startup", func(c *Config, v string) (err error) {
+		c.MinioProvision, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"MINIO_PUBLIC_PREFIXES", "minio-public-prefixes", "blog/,profile/", "comma separated prefixes readable anonymously, empty keeps the bucket private", func(c *Config, v string) error {
+		c.MinioPublicPrefixes = splitList(v)
+		return nil
+	}},
+	{"MINIO_VERSIONING", "minio-versioning", "", "bucket versioning, 'enabled', 'suspended' or empty to leave it untouched", func(c *Config, v string) error {
+		c.MinioVersioning = v
+		return nil
+	}},
+	{"MINIO_NONCURRENT_DAYS", "minio-noncurrent-days", "0", "expire noncurrent object versions after that many days, 0 disables", func(c *Config, v string) (err error) {
+		c.MinioNoncurrentDays, err = strconv.Atoi(v)
+		return err
+	}},
+	{"SECRET_KEY", "secret-key", "", "secret used to sign jwt when JWT_KEYS is empty", func(c *Config, v string) error {
+		c.JWTSecret = v
+		return nil
+	}},
+	{"JWT_KEYS", "jwt-keys", "", "comma separated kid=secret pairs accepted when verifying tokens", func(c *Config, v string) error {
+		for _, pair := range splitList(v) {
+			id, secret, ok := strings.Cut(pair, "=")
+			if !ok || id == "" {
+				return errors.New("expected kid=secret")
+			}
+			c.JWTKeys = append(c.JWTKeys, JWTKey{ID: id, Secret: secret})
+		}
+		return nil
+	}},
+	{"JWT_KEY_FILES", "jwt-key-files", "", "comma separated kid=path pairs of rsa or ed25519 pem keys", func(c *Config, v string) error {
+		for _, pair := range splitList(v) {
+			id, file, ok := strings.Cut(pair, "=")
+			if !ok || id == "" || file == "" {
+				return errors.New("expected kid=path")
+			}
+			c.JWTKeys = append(c.JWTKeys, JWTKey{ID: id, File: file})
+		}
+		return nil
+	}},
+	{"JWT_ACTIVE_KEY", "jwt-active-key", "", "kid of the key signing new tokens, defaults to the first of JWT_KEY_FILES, else of JWT_KEYS", func(c *Config, v string) error {
+		c.JWTActiveKey = v
+		return nil
+	}},
+	{"JWT_ISSUER", "jwt-issuer", "fadel-blog-services", "iss claim of issued tokens", func(c *Config, v string) error {
+		c.JWTIssuer = v
+		return nil
+	}},
+	{"JWT_AUDIENCE", "jwt-audience", "fadel-blog", "aud claim of issued tokens", func(c *Config, v string) error {
+		c.JWTAudience = v
+		return nil
+	}},
+	{"JWT_LEEWAY", "jwt-leeway", "30s", "clock skew tolerated when checking token times", func(c *Config, v string) (err error) {
+		c.JWTLeeway, err = time.ParseDuration(v)
+		return err
+	}},
+	{"ACCESS_TOKEN_TTL", "access-token-ttl", "15m", "lifetime of access tokens", func(c *Config, v string) (err error) {
+		c.AccessTokenTTL, err = time.ParseDuration(v)
+		return err
+	}},
+	{"REFRESH_TOKEN_TTL", "refresh-token-ttl", "720h", "lifetime of refresh tokens", func(c *Config, v string) (err error) {
+		c.RefreshTokenTTL, err = time.ParseDuration(v)
+		return err
+	}},
+	{"REVOCATION_REFRESH", "revocation-refresh", "10s", "how often the token revocation list is reloaded from mongodb", func(c *Config, v string) (err error) {
+		c.RevocationRefresh, err = time.ParseDuration(v)
+		return err
+	}},
+	{"PASSWORD_MIN_LENGTH", "password-min-length", "8", "minimum length of new passwords", func(c *Config, v string) (err error) {
+		c.PasswordMinLength, err = strconv.Atoi(v)
+		return err
+	}},
+	{"PASSWORD_BREACH_LIST", "password-breach-list", "", "file of breached passwords, one per line, refused as new passwords", func(c *Config, v string) error {
+		c.PasswordBreachList = v
+		return nil
+	}},
+	{"BCRYPT_COST", "bcrypt-cost", "12", "bcrypt cost of password hashes, lower hashes are upgraded at login", func(c *Config, v string) (err error) {
+		c.BcryptCost, err = strconv.Atoi(v)
+		return err
+	}},
+	{"LOGIN_MAX_FAILURES", "login-max-failures", "5", "failed logins of a username before it is locked out", func(c *Config, v string) (err error) {
+		c.LoginMaxFailures, err = strconv.Atoi(v)
+		return err
+	}},
+	{"LOGIN_MAX_IP_FAILURES", "login-max-ip-failures", "20", "failed logins from one client ip before it is locked out", func(c *Config, v string) (err error) {
+		c.LoginMaxIPFailures, err = strconv.Atoi(v)
+		return err
+	}},
+	{"LOGIN_BACKOFF", "login-backoff", "1s", "wait after the first failed login, doubled by every further one", func(c *Config, v string) (err error) {
+		c.LoginBackoff, err = time.ParseDuration(v)
+		return err
+	}},
+	{"LOGIN_LOCKOUT", "login-lockout", "15m", "how long a locked out username or ip has to wait", func(c *Config, v string) (err error) {
+		c.LoginLockout, err = time.ParseDuration(v)
+		return err
+	}},
+	{"LOGIN_FAILURE_WINDOW", "login-failure-window", "15m", "failed logins further apart than this start the count over", func(c *Config, v string) (err error) {
+		c.LoginFailureWindow, err = time.ParseDuration(v)
+		return err
+	}},
+	{"LOGIN_AUDIT_RETENTION", "login-audit-retention", "2160h", "how long failed logins are kept for auditing", func(c *Config, v string) (err error) {
+		c.LoginAuditRetention, err = time.ParseDuration(v)
+		return err
+	}},
+	{"LOGIN_HISTORY_RETENTION", "login-history-retention", "2160h", "how long sessions are kept as login history", func(c *Config, v string) (err error) {
+		c.LoginHistoryRetention, err = time.ParseDuration(v)
+		return err
+	}},
+	{"MAIL_DRIVER", "mail-driver", "file", "how mails are delivered, 'smtp' or 'file'", func(c *Config, v string) error {
+		c.MailDriver = v
+		return nil
+	}},
+	{"MAIL_FILE", "mail-file", "-", "file the 'file' mail driver appends to, '-' for stdout", func(c *Config, v string) error {
+		c.MailFile = v
+		return nil
+	}},
+	{"MAIL_FROM", "mail-from", "", "sender address of outgoing mails", func(c *Config, v string) error {
+		c.MailFrom = v
+		return nil
+	}},
+	{"SMTP_ADDR", "smtp-addr", "", "smtp relay host:port", func(c *Config, v string) error {
+		c.SMTPAddr = v
+		return nil
+	}},
+	{"SMTP_USERNAME", "smtp-username", "", "smtp username, empty sends without authentication", func(c *Config, v string) error {
+		c.SMTPUsername = v
+		return nil
+	}},
+	{"SMTP_PASSWORD", "smtp-password", "", "smtp password", func(c *Config, v string) error {
+		c.SMTPPassword = v
+		return nil
+	}},
+	{"MAIL_WORKERS", "mail-workers", "2", "mails sent at the same time", func(c *Config, v string) (err error) {
+		c.MailWorkers, err = strconv.Atoi(v)
+		return err
+	}},
+	{"MAIL_QUEUE_SIZE", "mail-queue-size", "100", "mails waiting to be sent before new ones are dropped", func(c *Config, v string) (err error) {
+		c.MailQueueSize, err = strconv.Atoi(v)
+		return err
+	}},
+	{"PASSWORD_RESET_URL", "password-reset-url", "http://localhost:3000/reset-password", "page password reset links point to, the token is added as ?token=", func(c *Config, v string) error {
+		c.PasswordResetURL = v
+		return nil
+	}},
+	{"PASSWORD_RESET_TTL", "password-reset-ttl", "1h", "lifetime of password reset tokens", func(c *Config, v string) (err error) {
+		c.PasswordResetTTL, err = time.ParseDuration(v)
+		return err
+	}},
+	{"PASSWORD_RESET_MAX_PER_EMAIL", "password-reset-max-per-email", "3", "password reset requests for one email before it is turned away", func(c *Config, v string) (err error) {
+		c.PasswordResetMaxPerEmail, err = strconv.Atoi(v)
+		return err
+	}},
+	{"PASSWORD_RESET_MAX_PER_IP", "password-reset-max-per-ip", "10", "password reset requests from one client ip before it is turned away", func(c *Config, v string) (err error) {
+		c.PasswordResetMaxPerIP, err = strconv.Atoi(v)
+		return err
+	}},
+	{"TOTP_ISSUER", "totp-issuer", "fadel-blog", "name authenticator apps show for two-factor codes", func(c *Config, v string) error {
+		c.TOTPIssuer = v
+		return nil
+	}},
+	{"TWO_FACTOR_CHALLENGE_TTL", "two-factor-challenge-ttl", "5m", "how long after the password the second factor may be given", func(c *Config, v string) (err error) {
+		c.TwoFactorChallengeTTL, err = time.ParseDuration(v)
+		return err
+	}},
+	{"PERSONAL_TOKEN_MAX_TTL", "personal-token-max-ttl", "8760h", "longest lifetime a personal access token may be given", func(c *Config, v string) (err error) {
+		c.PersonalTokenMaxTTL, err = time.ParseDuration(v)
+		return err
+	}},
+	{"OIDC_ISSUER", "oidc-issuer", "", "issuer url of the OpenID provider, empty disables oidc login", func(c *Config, v string) error {
+		c.OIDCIssuer = v
+		return nil
+	}},
+	{"OIDC_CLIENT_ID", "oidc-client-id", "", "client id registered at the OpenID provider", func(c *Config, v string) error {
+		c.OIDCClientID = v
+		return nil
+	}},
+	{"OIDC_CLIENT_SECRET", "oidc-client-secret", "", "client secret, empty for a public client relying on pkce", func(c *Config, v string) error {
+		c.OIDCClientSecret = v
+		return nil
+	}},
+	{"OIDC_REDIRECT_URL", "oidc-redirect-url", "", "page the OpenID provider redirects back to", func(c *Config, v string) error {
+		c.OIDCRedirectURL = v
+		return nil
+	}},
+	{"OIDC_SCOPES", "oidc-scopes", "openid,email,profile", "comma separated scopes requested from the OpenID provider", func(c *Config, v string) error {
+		c.OIDCScopes = splitList(v)
+		return nil
+	}},
+	{"OIDC_LOGIN_TTL", "oidc-login-ttl", "10m", "how long a started oidc login may take", func(c *Config, v string) (err error) {
+		c.OIDCLoginTTL, err = time.ParseDuration(v)
+		return err
+	}},
+	{"OIDC_DEFAULT_ROLE", "oidc-default-role", "contributor", "role of accounts provisioned by oidc login", func(c *Config, v string) error {
+		c.OIDCDefaultRole = v
+		return nil
+	}},
+	{"OIDC_AUTO_PROVISION", "oidc-auto-provision", "true", "create an account for unknown oidc identities", func(c *Config, v string) (err error) {
+		c.OIDCAutoProvision, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"OIDC_LINK_BY_EMAIL", "oidc-link-by-email", "false", "link oidc identities to the account with the same verified email, never admins or editors", func(c *Config, v string) (err error) {
+		c.OIDCLinkByEmail, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"HOST_PORT", "listen-addr", "0.0.0.0:8080", "address the http server listens on", func(c *Config, v string) error {
+		c.ListenAddr = v
+		return nil
+	}},
+	{"CORS_ORIGINS", "cors-origins", "*", "comma separated allowed origins, '*' allows all", func(c *Config, v string) error {
+		c.CORSOrigins = splitList(v)
+		return nil
+	}},
+	{"COOKIE_SESSIONS", "cookie-sessions", "false", "let logins asking for it keep their tokens in HttpOnly cookies", func(c *Config, v string) (err error) {
+		c.CookieSessions, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"COOKIE_DOMAIN", "cookie-domain", "", "domain of the session cookies, empty is the api host only", func(c *Config, v string) error {
+		c.CookieDomain = v
+		return nil
+	}},
+	{"COOKIE_SECURE", "cookie-secure", "true", "only send the session cookies over https", func(c *Config, v string) (err error) {
+		c.CookieSecure, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"COOKIE_SAMESITE", "cookie-samesite", "strict", "SameSite of the session cookies, 'strict', 'lax' or 'none'", func(c *Config, v string) error {
+		c.CookieSameSite = strings.ToLower(v)
+		return nil
+	}},
+	{"TRUSTED_PROXIES", "trusted-proxies", "", "comma separated proxy ips or cidrs allowed to set X-Forwarded-For", func(c *Config, v string) error {
+		c.TrustedProxies = splitList(v)
+		return nil
+	}},
+	{"GIN_MODE", "gin-mode", gin.DebugMode, "gin mode, 'debug', 'release' or 'test'", func(c *Config, v string) error {
+		c.GinMode = v
+		return nil
+	}},
+	{"LOG_LEVEL", "log-level", "info", "debug, info, warn or error", func(c *Config, v string) error {
+		c.LogLevel = strings.ToLower(v)
+		return nil
+	}},
+	{"LOG_FORMAT", "log-format", "json", "log output, 'json' or 'text'", func(c *Config, v string) error {
+		c.LogFormat = strings.ToLower(v)
+		return nil
+	}},
+	{"HTTP_READ_TIMEOUT", "read-timeout", "30s", "max duration for reading a whole request, including uploads", func(c *Config, v string) (err error) {
+		c.ReadTimeout, err = time.ParseDuration(v)
+		return err
+	}},
+	{"HTTP_WRITE_TIMEOUT", "write-timeout", "60s", "max duration before timing out writes of the response", func(c *Config, v string) (err error) {
+		c.WriteTimeout, err = time.ParseDuration(v)
+		return err
+	}},
+	{"HTTP_IDLE_TIMEOUT", "idle-timeout", "120s", "how long keep-alive connections stay open", func(c *Config, v string) (err error) {
+		c.IdleTimeout, err = time.ParseDuration(v)
+		return err
+	}},
+	{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "30s", "how long in-flight requests may run after SIGINT/SIGTERM", func(c *Config, v string) (err error) {
+		c.ShutdownTimeout, err = time.ParseDuration(v)
+		return err
+	}},
+}
+
+// Load builds the configuration from, in order of precedence, command line
+// flags, environment variables, the .env file and built-in defaults. Flags
+// stop at the first non-flag argument, the rest (a subcommand) is returned.
+func Load(args []string) (*Config, []string, error) {
+	fset := flag.NewFlagSet("fadel-blog-services", flag.ContinueOnError)
+	envFile := fset.String("env-file", ".env", "optional dotenv file")
+	flags := map[string]*string{}
+	for _, s := range settings {
+		flags[s.flag] = fset.String(s.flag, "", fmt.Sprintf("%s (env %s, default %q)", s.usage, s.env, s.def))
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	given := map[string]bool{}
+	fset.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	// a missing .env is fine (containers inject real env vars), unless it was asked for explicitly
+	dotenv, err := godotenv.Read(*envFile)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) || given["env-file"] {
+			return nil, nil, fmt.Errorf("reading %s: %w", *envFile, err)
+		}
+		dotenv = map[string]string{}
+	}
+
+	var cfg Config
+	var problems []string
+	for _, s := range settings {
+		value := s.def
+		if v, ok := dotenv[s.env]; ok {
+			value = v
+		}
+		if v, ok := os.LookupEnv(s.env); ok {
+			value = v
+		}
+		if given[s.flag] {
+			value = *flags[s.flag]
+		}
+
+		if err := s.apply(&cfg, strings.TrimSpace(value)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: invalid value %q", s.env, value))
+		}
+	}
+
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return nil, nil, &ValidationError{Problems: problems}
+	}
+
+	return &cfg, fset.Args(), nil
+}
+
+func (c *Config) validate() []string {
+	var problems []string
+
+	if c.MongoURI == "" {
+		problems = append(problems, "DB_URL is required")
+	} else if u, err := url.Parse(c.MongoURI); err != nil || (u.Scheme != "mongodb" && u.Scheme != "mongodb+srv") {
+		problems = append(problems, "DB_URL must be a mongodb:// or mongodb+srv:// uri")
+	}
+	if c.MongoDatabase == "" {
+		problems = append(problems, "DB_NAME is required")
+	}
+
+	switch c.StorageDriver {
+	case "minio":
+		if c.MinioEndpoint == "" {
+			problems = append(problems, "MINIO_ENDPOINT is required when STORAGE_DRIVER is minio")
+		}
+		if c.MinioAccessKeyID == "" {
+			problems = append(problems, "MINIO_ACCESS_KEY_ID is required when STORAGE_DRIVER is minio")
+		}
+		if c.MinioSecretKey == "" {
+			problems = append(problems, "MINIO_ACCESS_KEY_PASS is required when STORAGE_DRIVER is minio")
+		}
+		if c.MinioBucket == "" {
+			problems = append(problems, "MINIO_BUCKET is required when STORAGE_DRIVER is minio")
+		}
+		if c.MinioVersioning != "" && c.MinioVersioning != "enabled" && c.MinioVersioning != "suspended" {
+			problems = append(problems, fmt.Sprintf("MINIO_VERSIONING must be 'enabled', 'suspended' or empty, got %q", c.MinioVersioning))
+		}
+		if c.MinioNoncurrentDays < 0 {
+			problems = append(problems, "MINIO_NONCURRENT_DAYS must not be negative")
+		}
+	case "filesystem":
+		if c.StorageDir == "" {
+			problems = append(problems, "STORAGE_DIR is required when STORAGE_DRIVER is filesystem")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("STORAGE_DRIVER must be 'minio' or 'filesystem', got %q", c.StorageDriver))
+	}
+
+	// an old SECRET_KEY keeps verifying while moving to JWT_KEY_FILES
+	hasSecrets := false
+	for _, key := range c.JWTKeys {
+		hasSecrets = hasSecrets || key.File == ""
+	}
+	if !hasSecrets && c.JWTSecret != "" {
+		c.JWTKeys = append(c.JWTKeys, JWTKey{ID: "default", Secret: c.JWTSecret})
+	}
+	if len(c.JWTKeys) == 0 {
+		problems = append(problems, "SECRET_KEY, JWT_KEYS or JWT_KEY_FILES is required")
+	} else if c.JWTActiveKey == "" {
+		c.JWTActiveKey = c.defaultJWTKey()
+	}
+
+	seen := map[string]bool{}
+	activeFound := false
+	for _, key := range c.JWTKeys {
+		if seen[key.ID] {
+			problems = append(problems, fmt.Sprintf("jwt key %q is configured twice", key.ID))
+		}
+		seen[key.ID] = true
+		activeFound = activeFound || key.ID == c.JWTActiveKey
+
+		if key.File == "" && len(key.Secret) < minSecretLength {
+			problems = append(problems, fmt.Sprintf("jwt key %q must be at least %d characters", key.ID, minSecretLength))
+		}
+	}
+	if c.JWTLeeway < 0 || c.JWTLeeway > 5*time.Minute {
+		problems = append(problems, "JWT_LEEWAY must be between 0 and 5m")
+	}
+	if c.JWTIssuer == "" || c.JWTAudience == "" {
+		problems = append(problems, "JWT_ISSUER and JWT_AUDIENCE must not be empty")
+	}
+	if len(c.JWTKeys) > 0 && !activeFound {
+		problems = append(problems, fmt.Sprintf("JWT_ACTIVE_KEY %q is not one of JWT_KEYS or JWT_KEY_FILES", c.JWTActiveKey))
+	}
+
+	// 72 bytes is all bcrypt looks at
+	if c.PasswordMinLength < 1 || c.PasswordMinLength > 72 {
+		problems = append(problems, "PASSWORD_MIN_LENGTH must be between 1 and 72")
+	}
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		problems = append(problems, fmt.Sprintf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost))
+	}
+
+	if c.LoginMaxFailures < 1 || c.LoginMaxIPFailures < 1 {
+		problems = append(problems, "LOGIN_MAX_FAILURES and LOGIN_MAX_IP_FAILURES must be at least 1")
+	}
+
+	if c.PasswordResetMaxPerEmail < 1 || c.PasswordResetMaxPerIP < 1 {
+		problems = append(problems, "PASSWORD_RESET_MAX_PER_EMAIL and PASSWORD_RESET_MAX_PER_IP must be at least 1")
+	}
+
+	if c.MailWorkers < 1 || c.MailQueueSize < 1 {
+		problems = append(problems, "MAIL_WORKERS and MAIL_QUEUE_SIZE must be at least 1")
+	}
+	switch c.MailDriver {
+	case "smtp":
+		if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("SMTP_ADDR must be host:port when MAIL_DRIVER is smtp, got %q", c.SMTPAddr))
+		}
+		if c.MailFrom == "" {
+			problems = append(problems, "MAIL_FROM is required when MAIL_DRIVER is smtp")
+		}
+	case "file":
+		if c.MailFile == "" {
+			problems = append(problems, "MAIL_FILE is required when MAIL_DRIVER is file, '-' writes to stdout")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("MAIL_DRIVER must be 'smtp' or 'file', got %q", c.MailDriver))
+	}
+	// personal access tokens live whole days
+	if c.PersonalTokenMaxTTL < 24*time.Hour {
+		problems = append(problems, "PERSONAL_TOKEN_MAX_TTL must be at least 24h")
+	}
+	if c.TOTPIssuer == "" || strings.Contains(c.TOTPIssuer, ":") {
+		problems = append(problems, "TOTP_ISSUER must not be empty nor contain ':'")
+	}
+	if u, err := url.Parse(c.PasswordResetURL); err != nil || u.Scheme == "" || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("PASSWORD_RESET_URL must be an absolute url, got %q", c.PasswordResetURL))
+	}
+
+	if c.OIDCIssuer != "" {
+		problems = append(problems, c.validateOIDC()...)
+	}
+
+	if _, _, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		problems = append(problems, fmt.Sprintf("HOST_PORT must be host:port, got %q", c.ListenAddr))
+	}
+
+	if len(c.CORSOrigins) == 0 {
+		problems = append(problems, "CORS_ORIGINS must list at least one origin or '*'")
+	}
+	for _, origin := range c.CORSOrigins {
+		// the cors middleware allows every origin when any entry is '*'
+		if origin == "*" {
+			if len(c.CORSOrigins) > 1 {
+				problems = append(problems, "CORS_ORIGINS can't mix '*' with other origins")
+			}
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("CORS_ORIGINS entry %q is not an origin like https://example.com", origin))
+		}
+	}
+
+	// credentials go to exactly the listed origins, never to a pattern
+	if c.CookieSessions {
+		for _, origin := range c.CORSOrigins {
+			if strings.Contains(origin, "*") {
+				problems = append(problems, fmt.Sprintf("CORS_ORIGINS must list the exact frontend origins when COOKIE_SESSIONS is on, %q can't carry credentials", origin))
+			}
+		}
+	}
+	switch c.CookieSameSite {
+	case "strict", "lax":
+	case "none":
+		if !c.CookieSecure {
+			problems = append(problems, "COOKIE_SAMESITE=none needs COOKIE_SECURE=true")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("COOKIE_SAMESITE must be 'strict', 'lax' or 'none', got %q", c.CookieSameSite))
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				problems = append(problems, fmt.Sprintf("TRUSTED_PROXIES entry %q is not an ip or cidr", proxy))
+			}
+		}
+	}
+
+	timeouts := []struct {
+		env string
+		d   time.Duration
+	}{
+		{"HTTP_READ_TIMEOUT", c.ReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", c.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", c.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", c.ShutdownTimeout},
+		{"ACCESS_TOKEN_TTL", c.AccessTokenTTL},
+		{"REFRESH_TOKEN_TTL", c.RefreshTokenTTL},
+		{"REVOCATION_REFRESH", c.RevocationRefresh},
+		{"LOGIN_BACKOFF", c.LoginBackoff},
+		{"LOGIN_LOCKOUT", c.LoginLockout},
+		{"LOGIN_FAILURE_WINDOW", c.LoginFailureWindow},
+		{"LOGIN_AUDIT_RETENTION", c.LoginAuditRetention},
+		{"LOGIN_HISTORY_RETENTION", c.LoginHistoryRetention},
+		{"PASSWORD_RESET_TTL", c.PasswordResetTTL},
+		{"TWO_FACTOR_CHALLENGE_TTL", c.TwoFactorChallengeTTL},
+		{"OIDC_LOGIN_TTL", c.OIDCLoginTTL},
+	}
+	for _, t := range timeouts {
+		if t.d <= 0 {
+			problems = append(problems, fmt.Sprintf("%s must be a positive duration", t.env))
+		}
+	}
+
+	switch c.GinMode {
+	case gin.DebugMode, gin.ReleaseMode, gin.TestMode:
+	default:
+		problems = append(problems, fmt.Sprintf("GIN_MODE must be debug, release or test, got %q", c.GinMode))
+	}
+
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("LOG_LEVEL must be debug, info, warn or error, got %q", c.LogLevel))
+	}
+	if c.LogFormat != "json" && c.LogFormat != "text" {
+		problems = append(problems, fmt.Sprintf("LOG_FORMAT must be json or text, got %q", c.LogFormat))
+	}
+
+	return problems
+}
+
+// defaultJWTKey is the first pem key, so adding JWT_KEY_FILES switches
+// signing over while SECRET_KEY still verifies older tokens
+func (c *Config) defaultJWTKey() string {
+	for _, key := range c.JWTKeys {
+		if key.File != "" {
+			return key.ID
+		}
+	}
+	return c.JWTKeys[0].ID
+}
+
+func (c *Config) validateOIDC() []string {
+	var problems []string
+
+	// plain http only for a provider on this machine, like a mock issuer
+	if u, err := url.Parse(c.OIDCIssuer); err != nil || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		problems = append(problems, fmt.Sprintf("OIDC_ISSUER must be an absolute url, got %q", c.OIDCIssuer))
+	} else if u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname())) {
+		problems = append(problems, "OIDC_ISSUER must be https unless it is on localhost")
+	}
+	if c.OIDCClientID == "" {
+		problems = append(problems, "OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+	}
+	if u, err := url.Parse(c.OIDCRedirectURL); err != nil || u.Scheme == "" || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("OIDC_REDIRECT_URL must be an absolute url, got %q", c.OIDCRedirectURL))
+	}
+	hasOpenID := false
+	for _, scope := range c.OIDCScopes {
+		hasOpenID = hasOpenID || scope == "openid"
+	}
+	if !hasOpenID {
+		problems = append(problems, "OIDC_SCOPES must include openid")
+	}
+
+	return problems
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// AllowAllOrigins reports whether CORS_ORIGINS is the "*" wildcard
+func (c *Config) AllowAllOrigins() bool {
+	return len(c.CORSOrigins) == 1 && c.CORSOrigins[0] == "*"
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
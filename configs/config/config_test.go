@@ -0,0 +1,62 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// setRequired sets the settings Load can't do without
+func setRequired(t *testing.T) {
+	t.Helper()
+	t.Setenv("DB_URL", "mongodb://localhost:27017")
+	t.Setenv("SECRET_KEY", "0123456789abcdef0123456789abcdef")
+	t.Setenv("STORAGE_DRIVER", "filesystem")
+}
+
+func TestCORSOrigins(t *testing.T) {
+	tests := []struct {
+		name           string
+		origins        string
+		cookieSessions string
+		wantProblem    string
+	}{
+		{"wildcard without cookies", "*", "false", ""},
+		{"listed origins without cookies", "https://a.example.com,https://b.example.com", "false", ""},
+		{"listed origins with cookies", "https://a.example.com", "true", ""},
+		{"wildcard with cookies", "*", "true", "can't carry credentials"},
+		{"wildcard among origins", "https://a.example.com,*", "false", "can't mix '*'"},
+		{"wildcard among origins with cookies", "https://a.example.com,*", "true", "can't carry credentials"},
+		{"pattern with cookies", "https://*.example.com", "true", "can't carry credentials"},
+		{"not an origin", "example.com", "false", "is not an origin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequired(t)
+			t.Setenv("CORS_ORIGINS", tt.origins)
+			t.Setenv("COOKIE_SESSIONS", tt.cookieSessions)
+
+			_, _, err := Load(nil)
+			if tt.wantProblem == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantProblem) {
+				t.Fatalf("got %v, want a problem with %q", err, tt.wantProblem)
+			}
+		})
+	}
+}
+
+func TestPositiveCounts(t *testing.T) {
+	for _, env := range []string{"LOGIN_MAX_FAILURES", "PASSWORD_RESET_MAX_PER_EMAIL", "PASSWORD_RESET_MAX_PER_IP", "MAIL_WORKERS", "MAIL_QUEUE_SIZE"} {
+		t.Run(env, func(t *testing.T) {
+			setRequired(t)
+			t.Setenv(env, "0")
+			if _, _, err := Load(nil); err == nil || !strings.Contains(err.Error(), env) {
+				t.Fatalf("got %v, want a problem with %s", err, env)
+			}
+		})
+	}
+}
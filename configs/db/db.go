@@ -2,35 +2,31 @@ package db
 
 import (
 	"context"
-	"fadel-blog-services/configs/helpers"
-	"fmt"
 	"time"
 
+	"fadel-blog-services/configs/config"
+
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-var DB, Ctx = connectDB()
-
-func connectDB() (*mongo.Database, context.Context) {
-	// Open mongodb connection
-	uri := helpers.GetEnvVariable("DB_URL")
-	// Declare Context type object for managing multiple API requests
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// Connect opens the mongodb connection and makes sure the primary answers.
+// The caller owns the returned client and must Disconnect it.
+func Connect(ctx context.Context, cfg *config.Config) (*mongo.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.MongoURI))
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	// Ping the primary / Check the connection
 	if err := client.Ping(ctx, readpref.Primary()); err != nil {
-		panic(err)
+		client.Disconnect(context.Background())
+		return nil, err
 	}
 
-	db := client.Database("fadel-blog")
-	fmt.Println("database connected...")
-	return db, ctx
+	return client, nil
 }
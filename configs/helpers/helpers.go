@@ -4,24 +4,16 @@ import (
 	"errors"
 	"log"
 	"net/http"
-	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 
+	"fadel-blog-services/configs/logger"
+
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 	uuid "github.com/nu7hatch/gouuid"
 )
 
-func GetEnvVariable(key string) string {
-	// load .env file and get env variable value based on "key"
-	if err := godotenv.Load(".env"); err != nil {
-		log.Fatalf("Error loading .env file")
-	}
-
-	return os.Getenv(key)
-}
-
 func CreateUUIDStr() (string, error) {
 	// generate an uuid and return it as a string
 	u4, err := uuid.NewV4()
@@ -45,15 +37,27 @@ func CreateSlug(str string) string {
 	return str
 }
 
-func ValidateImage(c *gin.Context, file string) error {
-	var imageType, _ = regexp.Compile(`^.*\.(jpeg|JPEG|jpg|JPG|gif|GIF|png|PNG|svg|SVG|webp|WebP|WEBP)$`)
-	if isImage := imageType.MatchString(file); !isImage {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "failed",
-			"message": "tolong masukkan file dalam format gambar (png, jpg, dsb)",
-		})
-		c.Abort()
+// imageTypes are the images ValidateImage accepts, by extension. SVG is
+// left out on purpose, it can carry scripts.
+var imageTypes = map[string]string{
+	".jpeg": "image/jpeg",
+	".jpg":  "image/jpeg",
+	".gif":  "image/gif",
+	".png":  "image/png",
+	".webp": "image/webp",
+}
 
+// ImageContentType is the content type of an image by its file extension,
+// false for anything ValidateImage rejects. Uploads are stored and served
+// with it, never with the type the client claimed.
+func ImageContentType(file string) (string, bool) {
+	contentType, ok := imageTypes[strings.ToLower(filepath.Ext(file))]
+	return contentType, ok
+}
+
+func ValidateImage(c *gin.Context, file string) error {
+	if _, isImage := ImageContentType(file); !isImage {
+		SendFailed(c, http.StatusOK, "tolong masukkan file dalam format gambar (png, jpg, dsb)")
 		return errors.New("invalid type")
 	}
 
@@ -63,12 +67,7 @@ func ValidateImage(c *gin.Context, file string) error {
 func ValidatePdf(c *gin.Context, file string) error {
 	var pdfType, _ = regexp.Compile(`^.*\.(pdf|PDF)$`)
 	if isImage := pdfType.MatchString(file); !isImage {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "failed",
-			"message": "tolong masukkan cv dalam format pdf",
-		})
-		c.Abort()
-
+		SendFailed(c, http.StatusBadRequest, "tolong masukkan cv dalam format pdf")
 		return errors.New("invalid type")
 	}
 
@@ -76,10 +75,17 @@ func ValidatePdf(c *gin.Context, file string) error {
 }
 
 // HTTP Response
-func SendInternalServerError(c *gin.Context, err error) {
-	c.JSON(http.StatusInternalServerError, gin.H{
-		"status":  "failed",
-		"message": err.Error(),
+func SendFailed(c *gin.Context, code int, message string) {
+	c.JSON(code, gin.H{
+		"status":     "failed",
+		"message":    message,
+		"request_id": c.GetString(logger.RequestIDKey),
 	})
 	c.Abort()
 }
+
+func SendInternalServerError(c *gin.Context, err error) {
+	c.Error(err)
+	logger.From(c.Request.Context()).Error("request failed", "error", err)
+	SendFailed(c, http.StatusInternalServerError, err.Error())
+}
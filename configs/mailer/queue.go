@@ -0,0 +1,75 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var ErrQueueFull = errors.New("mail queue is full")
+
+// Queue sends messages through a Mailer from a fixed number of workers, so
+// a flood of requests can't open a flood of smtp connections. Send only
+// queues the message, it fails with ErrQueueFull instead of waiting.
+type Queue struct {
+	mailer   Mailer
+	timeout  time.Duration
+	messages chan Message
+	workers  sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewQueue starts workers that send up to size queued messages, each
+// given timeout to be delivered
+func NewQueue(m Mailer, workers, size int, timeout time.Duration) *Queue {
+	q := &Queue{mailer: m, timeout: timeout, messages: make(chan Message, size)}
+	for i := 0; i < workers; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+func (q *Queue) Send(ctx context.Context, msg Message) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return errors.New("mail queue is closed")
+	}
+
+	select {
+	case q.messages <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (q *Queue) work() {
+	defer q.workers.Done()
+
+	for msg := range q.messages {
+		ctx, cancel := context.WithTimeout(context.Background(), q.timeout)
+		if err := q.mailer.Send(ctx, msg); err != nil {
+			slog.Error("sending mail", "subject", msg.Subject, "error", err)
+		}
+		cancel()
+	}
+}
+
+// Close stops taking messages and waits until the queued ones are sent
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.messages)
+	}
+	q.mu.Unlock()
+
+	q.workers.Wait()
+}
@@ -0,0 +1,62 @@
+package mailer
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingMailer records messages, holding every Send until release closes.
+// started gets a value whenever a Send begins.
+type blockingMailer struct {
+	started chan struct{}
+	release chan struct{}
+	mu      sync.Mutex
+	sent    []Message
+}
+
+func (m *blockingMailer) Send(ctx context.Context, msg Message) error {
+	m.started <- struct{}{}
+	<-m.release
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestQueue(t *testing.T) {
+	m := &blockingMailer{started: make(chan struct{}, 10), release: make(chan struct{})}
+	q := NewQueue(m, 1, 2, time.Second)
+	ctx := context.Background()
+
+	// one message is taken by the worker, two wait, the rest don't fit
+	var queued int
+	for i := 0; i < 10; i++ {
+		err := q.Send(ctx, Message{To: "ann@example.com", Subject: "hi"})
+		switch err {
+		case nil:
+			queued++
+		case ErrQueueFull:
+		default:
+			t.Fatal(err)
+		}
+		// the worker has to hold the first message before the queue fills
+		if i == 0 {
+			<-m.started
+		}
+	}
+	if queued != 3 {
+		t.Fatalf("queued %d messages, want 3", queued)
+	}
+
+	close(m.release)
+	q.Close()
+	if len(m.sent) != queued {
+		t.Fatalf("sent %d of %d queued messages", len(m.sent), queued)
+	}
+	if err := q.Send(ctx, Message{}); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Fatalf("send after close: %v", err)
+	}
+}
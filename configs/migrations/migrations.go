@@ -0,0 +1,376 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// All is every migration of the service, append new ones with the next
+// version number and never change one that has shipped
+var All = []Migration{
+	{
+		Version: 1,
+		Name:    "create user indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("user"), uniqueIndex("username"), uniqueIndex("user_id"))
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndexes(ctx, db.Collection("user"), "username_unique", "user_id_unique")
+		},
+	},
+	{
+		Version: 2,
+		Name:    "deduplicate blog slugs and create blog indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := deduplicateSlugs(ctx, db.Collection("blog")); err != nil {
+				return err
+			}
+			return createIndexes(ctx, db.Collection("blog"), uniqueIndex("blog_id"), uniqueIndex("slug"))
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndexes(ctx, db.Collection("blog"), "blog_id_unique", "slug_unique")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create refresh token indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("refresh_token"),
+				uniqueIndex("token_hash"),
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "family_id", Value: 1}},
+					Options: options.Index().SetName("family_id"),
+				},
+				ttlIndex("expires_at"),
+			)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection("refresh_token").Drop(ctx)
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create revoked token indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("revoked_token"), ttlIndex("expires_at"))
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection("revoked_token").Drop(ctx)
+		},
+	},
+	{
+		// every account could do everything before roles existed, keeping
+		// them admins means nobody is locked out by the upgrade. Narrow them
+		// down afterwards with `user set-role`.
+		Version: 5,
+		Name:    "give existing users the admin role",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return changeMany(ctx, db, 5, "user", "user_id",
+				bson.M{"role": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"role": legacyUserRole}},
+			)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return undoChanges(ctx, db, 5, "user", "user_id", bson.M{"$unset": bson.M{"role": ""}})
+		},
+	},
+	{
+		Version: 6,
+		Name:    "attribute existing blogs to their last editor",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// the creator was never recorded, updated_by is the best guess
+			err := changeMany(ctx, db, 6, "blog", "blog_id",
+				bson.M{"author_id": bson.M{"$exists": false}},
+				mongo.Pipeline{{{Key: "$set", Value: bson.M{
+					"author_id":  "$updated_by",
+					"created_by": "$updated_by",
+				}}}},
+			)
+			if err != nil {
+				return err
+			}
+			return createIndexes(ctx, db.Collection("blog"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "author_id", Value: 1}},
+				Options: options.Index().SetName("author_id"),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := dropIndexes(ctx, db.Collection("blog"), "author_id"); err != nil {
+				return err
+			}
+			return undoChanges(ctx, db, 6, "blog", "blog_id", bson.M{"$unset": bson.M{"author_id": "", "created_by": ""}})
+		},
+	},
+	{
+		Version: 7,
+		Name:    "create login throttling indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			err := createIndexes(ctx, db.Collection("login_counter"), uniqueIndex("key"), ttlIndex("expires_at"))
+			if err != nil {
+				return err
+			}
+			return createIndexes(ctx, db.Collection("login_failure"),
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "username", Value: 1}, {Key: "at", Value: -1}},
+					Options: options.Index().SetName("username_at"),
+				},
+				ttlIndex("expires_at"),
+			)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := db.Collection("login_counter").Drop(ctx); err != nil {
+				return err
+			}
+			return db.Collection("login_failure").Drop(ctx)
+		},
+	},
+	{
+		Version: 8,
+		Name:    "create email and password reset indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// email is optional, only accounts that have one must not share it
+			err := createIndexes(ctx, db.Collection("user"), mongo.IndexModel{
+				Keys: bson.D{{Key: "email", Value: 1}},
+				Options: options.Index().SetName("email_unique").SetUnique(true).
+					SetPartialFilterExpression(bson.M{"email": bson.M{"$type": "string"}}),
+			})
+			if err != nil {
+				return err
+			}
+			return createIndexes(ctx, db.Collection("password_reset"),
+				uniqueIndex("token_hash"),
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "user_id", Value: 1}},
+					Options: options.Index().SetName("user_id"),
+				},
+				ttlIndex("expires_at"),
+			)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := dropIndexes(ctx, db.Collection("user"), "email_unique"); err != nil {
+				return err
+			}
+			return db.Collection("password_reset").Drop(ctx)
+		},
+	},
+	{
+		Version: 9,
+		Name:    "create access token indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("access_token"),
+				uniqueIndex("token_hash"),
+				uniqueIndex("token_id"),
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+					Options: options.Index().SetName("user_id_created_at"),
+				},
+				ttlIndex("expires_at"),
+			)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection("access_token").Drop(ctx)
+		},
+	},
+	{
+		Version: 10,
+		Name:    "create oidc identity and login indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// only accounts linked to an identity provider have a subject
+			err := createIndexes(ctx, db.Collection("user"), mongo.IndexModel{
+				Keys: bson.D{{Key: "oidc_issuer", Value: 1}, {Key: "oidc_subject", Value: 1}},
+				Options: options.Index().SetName("oidc_subject_unique").SetUnique(true).
+					SetPartialFilterExpression(bson.M{"oidc_subject": bson.M{"$type": "string"}}),
+			})
+			if err != nil {
+				return err
+			}
+			return createIndexes(ctx, db.Collection("oidc_login"),
+				uniqueIndex("state_hash"),
+				ttlIndex("expires_at"),
+			)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := dropIndexes(ctx, db.Collection("user"), "oidc_subject_unique"); err != nil {
+				return err
+			}
+			return db.Collection("oidc_login").Drop(ctx)
+		},
+	},
+	{
+		Version: 11,
+		Name:    "create session indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("session"),
+				uniqueIndex("session_id"),
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+					Options: options.Index().SetName("user_id_created_at"),
+				},
+				ttlIndex("purge_at"),
+			)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection("session").Drop(ctx)
+		},
+	},
+}
+
+// legacyUserRole is what migration 5 gives accounts from before roles
+const legacyUserRole = "admin"
+
+// ttlIndex lets mongo purge documents once the time in field has passed
+func ttlIndex(field string) mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys:    bson.D{{Key: field, Value: 1}},
+		Options: options.Index().SetName(field + "_ttl").SetExpireAfterSeconds(0),
+	}
+}
+
+func uniqueIndex(field string) mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys:    bson.D{{Key: field, Value: 1}},
+		Options: options.Index().SetName(field + "_unique").SetUnique(true),
+	}
+}
+
+func createIndexes(ctx context.Context, coll *mongo.Collection, models ...mongo.IndexModel) error {
+	_, err := coll.Indexes().CreateMany(ctx, models)
+	return err
+}
+
+func dropIndexes(ctx context.Context, coll *mongo.Collection, names ...string) error {
+	for _, name := range names {
+		if _, err := coll.Indexes().DropOne(ctx, name); err != nil {
+			if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Name == "IndexNotFound" {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// migrationChange records a document changed by the Up of a migration, so
+// its Down reverts that document and leaves the ones written since alone
+type migrationChange struct {
+	Version    int    `bson:"version"`
+	Collection string `bson:"collection"`
+	DocId      string `bson:"doc_id"`
+}
+
+// changeMany applies update to the documents of collection matching filter
+// and records their idField in the "migration_change" collection. Matching
+// documents are recorded before they change, a rerun after a failure
+// records them again, which undoChanges doesn't mind.
+func changeMany(ctx context.Context, db *mongo.Database, version int, collection, idField string, filter bson.M, update any) error {
+	coll := db.Collection(collection)
+	cursor, err := coll.Find(ctx, filter, options.Find().SetProjection(bson.M{idField: 1}))
+	if err != nil {
+		return err
+	}
+
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(docs))
+	changes := make([]any, 0, len(docs))
+	for _, doc := range docs {
+		id, ok := doc[idField].(string)
+		if !ok {
+			return fmt.Errorf("%s document %v has no %s", collection, doc["_id"], idField)
+		}
+		ids = append(ids, id)
+		changes = append(changes, migrationChange{Version: version, Collection: collection, DocId: id})
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if _, err := db.Collection("migration_change").InsertMany(ctx, changes); err != nil {
+		return err
+	}
+
+	// documents written since the find keep their own values
+	filter = bson.M{"$and": bson.A{filter, bson.M{idField: bson.M{"$in": ids}}}}
+	_, err = coll.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// undoChanges applies update to the documents changeMany recorded for
+// version and forgets them
+func undoChanges(ctx context.Context, db *mongo.Database, version int, collection, idField string, update any) error {
+	record := bson.M{"version": version, "collection": collection}
+	cursor, err := db.Collection("migration_change").Find(ctx, record)
+	if err != nil {
+		return err
+	}
+
+	var changes []migrationChange
+	if err := cursor.All(ctx, &changes); err != nil {
+		return err
+	}
+
+	if len(changes) > 0 {
+		ids := make([]string, len(changes))
+		for i, change := range changes {
+			ids[i] = change.DocId
+		}
+		if _, err := db.Collection(collection).UpdateMany(ctx, bson.M{idField: bson.M{"$in": ids}}, update); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Collection("migration_change").DeleteMany(ctx, record)
+	return err
+}
+
+// deduplicateSlugs renames every slug that is used more than once, the
+// oldest post keeps the original and later ones get "-2", "-3", ...
+func deduplicateSlugs(ctx context.Context, coll *mongo.Collection) error {
+	cursor, err := coll.Find(ctx, bson.M{}, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetProjection(bson.M{"blog_id": 1, "slug": 1}))
+	if err != nil {
+		return err
+	}
+
+	var blogs []struct {
+		BlogId string `bson:"blog_id"`
+		Slug   string `bson:"slug"`
+	}
+	if err := cursor.All(ctx, &blogs); err != nil {
+		return err
+	}
+
+	taken := map[string]bool{}
+	for _, blog := range blogs {
+		taken[blog.Slug] = true
+	}
+
+	seen := map[string]bool{}
+	for _, blog := range blogs {
+		if !seen[blog.Slug] {
+			seen[blog.Slug] = true
+			continue
+		}
+
+		slug := blog.Slug
+		for n := 2; taken[slug]; n++ {
+			slug = fmt.Sprintf("%s-%d", blog.Slug, n)
+		}
+		taken[slug] = true
+
+		_, err := coll.UpdateOne(ctx, bson.M{"blog_id": blog.BlogId}, bson.M{"$set": bson.M{"slug": slug}})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testDatabase connects to MONGO_TEST_URL and hands out a fresh database
+// that is dropped afterwards. Without the variable the test is skipped, the
+// migrations only make sense against a real mongodb.
+func testDatabase(t *testing.T) *mongo.Database {
+	t.Helper()
+	uri := os.Getenv("MONGO_TEST_URL")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URL not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	database := client.Database(fmt.Sprintf("migrations_test_%d", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		database.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+	return database
+}
+
+func migration(t *testing.T, version int) Migration {
+	t.Helper()
+	for _, m := range All {
+		if m.Version == version {
+			return m
+		}
+	}
+	t.Fatalf("no migration %d", version)
+	return Migration{}
+}
+
+func TestBackfillRole(t *testing.T) {
+	ctx := context.Background()
+	database := testDatabase(t)
+	users := database.Collection("user")
+
+	_, err := users.InsertMany(ctx, []any{
+		bson.M{"user_id": "legacy", "username": "legacy"},
+		bson.M{"user_id": "author", "username": "author", "role": "author"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := migration(t, 5)
+	if err := m.Up(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+
+	// written after the upgrade, Down leaves it alone
+	if _, err := users.InsertOne(ctx, bson.M{"user_id": "new", "username": "new", "role": "admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	roleOf := func(userId string) any {
+		var doc bson.M
+		if err := users.FindOne(ctx, bson.M{"user_id": userId}).Decode(&doc); err != nil {
+			t.Fatal(err)
+		}
+		return doc["role"]
+	}
+
+	tests := []struct {
+		userId   string
+		wantUp   any
+		wantDown any
+	}{
+		{"legacy", "admin", nil},
+		{"author", "author", "author"},
+		{"new", "admin", "admin"},
+	}
+	for _, tt := range tests {
+		if got := roleOf(tt.userId); got != tt.wantUp {
+			t.Errorf("after up %s has role %v, want %v", tt.userId, got, tt.wantUp)
+		}
+	}
+
+	if err := m.Down(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := roleOf(tt.userId); got != tt.wantDown {
+			t.Errorf("after down %s has role %v, want %v", tt.userId, got, tt.wantDown)
+		}
+	}
+}
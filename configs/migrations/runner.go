@@ -0,0 +1,224 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"fadel-blog-services/configs/helpers"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration is a single versioned schema change. Up must be safe to re-run
+// when a previous attempt died halfway, Down reverts it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+type Status struct {
+	Version   int        `bson:"version" json:"version"`
+	Name      string     `bson:"name" json:"name"`
+	AppliedAt *time.Time `bson:"applied_at,omitempty" json:"applied_at"`
+}
+
+// Runner applies migrations and records them in the "migrations" collection
+type Runner struct {
+	// LockTTL is how long the lock taken by Up and Down holds, it has to
+	// outlast the slowest run. A runner that died keeps the others waiting
+	// that long, which is also how long they wait at most.
+	LockTTL time.Duration
+
+	db         *mongo.Database
+	coll       *mongo.Collection
+	locks      *mongo.Collection
+	migrations []Migration
+}
+
+var ErrLocked = errors.New("another process is applying migrations")
+
+const lockId = "migrations"
+
+func NewRunner(db *mongo.Database, migrations []Migration) *Runner {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	return &Runner{
+		LockTTL:    10 * time.Minute,
+		db:         db,
+		coll:       db.Collection("migrations"),
+		locks:      db.Collection("migration_lock"),
+		migrations: sorted,
+	}
+}
+
+// lock makes sure only one process applies or reverts migrations at a time,
+// two replicas starting together would otherwise both run the same Up. It
+// waits up to LockTTL for the current holder and returns the unlock func.
+func (r *Runner) lock(ctx context.Context) (func(), error) {
+	owner, err := helpers.CreateUUIDStr()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(r.LockTTL)
+	for {
+		// a held lock doesn't match the filter, the upsert then collides
+		// with it on _id
+		now := time.Now()
+		_, err := r.locks.UpdateOne(ctx,
+			bson.M{"_id": lockId, "expires_at": bson.M{"$lt": now}},
+			bson.M{"$set": bson.M{"owner": owner, "expires_at": now.Add(r.LockTTL)}},
+			options.Update().SetUpsert(true),
+		)
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		if now.After(deadline) {
+			return nil, ErrLocked
+		}
+
+		slog.Info("waiting for the migration lock")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+
+	return func() {
+		if _, err := r.locks.DeleteOne(context.Background(), bson.M{"_id": lockId, "owner": owner}); err != nil {
+			slog.Error("releasing the migration lock", "error", err)
+		}
+	}, nil
+}
+
+func (r *Runner) applied(ctx context.Context) (map[int]Status, error) {
+	// the unique index keeps two replicas starting at once from recording a version twice
+	_, err := r.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := r.coll.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Status
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := map[int]Status{}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// Status lists every known migration, AppliedAt is nil for pending ones
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []Status{}
+	for _, m := range r.migrations {
+		status := Status{Version: m.Version, Name: m.Name}
+		if record, ok := applied[m.Version]; ok {
+			status.AppliedAt = record.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration in version order and returns how many ran
+func (r *Runner) Up(ctx context.Context) (int, error) {
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	// read under the lock, the previous holder may have applied them all
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range r.migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		slog.Info("applying migration", "version", m.Version, "name", m.Name)
+		if err := m.Up(ctx, r.db); err != nil {
+			return count, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+
+		now := time.Now()
+		_, err := r.coll.InsertOne(ctx, Status{Version: m.Version, Name: m.Name, AppliedAt: &now})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return count, fmt.Errorf("recording migration %d: %w", m.Version, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Down reverts the last `steps` applied migrations, newest first
+func (r *Runner) Down(ctx context.Context, steps int) (int, error) {
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(r.migrations) - 1; i >= 0 && count < steps; i-- {
+		m := r.migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+
+		slog.Info("reverting migration", "version", m.Version, "name", m.Name)
+		if m.Down == nil {
+			return count, fmt.Errorf("migration %d %s can't be reverted", m.Version, m.Name)
+		}
+		if err := m.Down(ctx, r.db); err != nil {
+			return count, fmt.Errorf("reverting migration %d %s: %w", m.Version, m.Name, err)
+		}
+
+		if _, err := r.coll.DeleteOne(ctx, bson.M{"version": m.Version}); err != nil {
+			return count, fmt.Errorf("unrecording migration %d: %w", m.Version, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
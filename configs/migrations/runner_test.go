@@ -0,0 +1,68 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestRunnerLock(t *testing.T) {
+	ctx := context.Background()
+	database := testDatabase(t)
+
+	var runs int32
+	slow := []Migration{{
+		Version: 1,
+		Name:    "slow",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			atomic.AddInt32(&runs, 1)
+			time.Sleep(200 * time.Millisecond)
+			return nil
+		},
+	}}
+
+	// replicas starting together apply the migration once
+	var wg sync.WaitGroup
+	counts := make([]int, 3)
+	errs := make([]error, 3)
+	for i := range counts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			counts[i], errs[i] = NewRunner(database, slow).Up(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	total := 0
+	for i := range counts {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		total += counts[i]
+	}
+	if runs != 1 || total != 1 {
+		t.Fatalf("migration ran %d times, %d recorded, want 1", runs, total)
+	}
+
+	// a held lock turns a runner away once LockTTL is over
+	holder := NewRunner(database, slow)
+	unlock, err := holder.lock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiting := NewRunner(database, slow)
+	waiting.LockTTL = 0
+	if _, err := waiting.Up(ctx); !errors.Is(err, ErrLocked) {
+		t.Fatalf("got %v, want ErrLocked", err)
+	}
+	unlock()
+	if _, err := waiting.Up(ctx); err != nil {
+		t.Fatalf("after unlock: %v", err)
+	}
+}
@@ -1,30 +1,16 @@
 package minio
 
 import (
-	"fadel-blog-services/configs/helpers"
-	"fmt"
+	"fadel-blog-services/configs/config"
 
 	miniosdk "github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
-var MinioClient = connectMinio()
-
-func connectMinio() *miniosdk.Client {
-	endpoint := helpers.GetEnvVariable("MINIO_ENDPOINT")
-	accessKeyID := helpers.GetEnvVariable("MINIO_ACCESS_KEY_ID")
-	secretAccessKey := helpers.GetEnvVariable("MINIO_ACCESS_KEY_PASS")
-	useSSL := false
-
+func Connect(cfg *config.Config) (*miniosdk.Client, error) {
 	// Initialize minio client object.
-	minioClient, err := miniosdk.New(endpoint, &miniosdk.Options{
-		Creds:  credentials.NewStaticV4(accessKeyID, secretAccessKey, ""),
-		Secure: useSSL,
+	return miniosdk.New(cfg.MinioEndpoint, &miniosdk.Options{
+		Creds:  credentials.NewStaticV4(cfg.MinioAccessKeyID, cfg.MinioSecretKey, ""),
+		Secure: cfg.MinioUseSSL,
 	})
-	if err != nil {
-		panic(err)
-	}
-
-	fmt.Println("minio connected...")
-	return minioClient
 }
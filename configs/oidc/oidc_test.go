@@ -0,0 +1,143 @@
+package oidc_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"fadel-blog-services/configs/oidc"
+	"fadel-blog-services/configs/oidc/oidctest"
+)
+
+func newTestIssuer(t *testing.T) *oidctest.Issuer {
+	t.Helper()
+	issuer, err := oidctest.NewIssuer("blog", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+// authorize runs the browser part of a login against issuer and returns
+// the code along with the verifier and nonce the provider side keeps
+func authorize(t *testing.T, issuer *oidctest.Issuer, p *oidc.Provider) (code, verifier, nonce string) {
+	t.Helper()
+	ctx := context.Background()
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err = oidc.NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := p.AuthCodeURL(ctx, "state-1", nonce, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state, err := issuer.Authorize(authURL)
+	if err != nil || code == "" || state != "state-1" {
+		t.Fatalf("authorize: code %q state %q %v", code, state, err)
+	}
+	return code, verifier, nonce
+}
+
+func TestProviderLogin(t *testing.T) {
+	issuer := newTestIssuer(t)
+	issuer.SetIdentity(oidctest.Identity{Subject: "s1", Email: "ann@example.com", EmailVerified: true, PreferredUsername: "ann"})
+	p := oidc.NewProvider(issuer.URL()+"/", "blog", "s3cret", "http://localhost:3000/oidc/callback", []string{"openid", "email"})
+	ctx := context.Background()
+
+	code, verifier, nonce := authorize(t, issuer, p)
+	raw, err := p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := p.VerifyIDToken(ctx, raw, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := oidc.Claims{Issuer: issuer.URL(), Subject: "s1", Email: "ann@example.com", EmailVerified: true, PreferredUsername: "ann"}
+	if claims != want {
+		t.Fatalf("claims %+v, want %+v", claims, want)
+	}
+}
+
+func TestProviderRejects(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		// run gets a fresh issuer and provider and returns the error of the
+		// step that has to fail
+		run func(t *testing.T, issuer *oidctest.Issuer, p *oidc.Provider) error
+	}{
+		{"wrong verifier", func(t *testing.T, issuer *oidctest.Issuer, p *oidc.Provider) error {
+			code, _, _ := authorize(t, issuer, p)
+			wrong, _, _ := oidc.NewPKCE()
+			_, err := p.Exchange(ctx, code, wrong)
+			return err
+		}},
+		{"code used twice", func(t *testing.T, issuer *oidctest.Issuer, p *oidc.Provider) error {
+			code, verifier, _ := authorize(t, issuer, p)
+			if _, err := p.Exchange(ctx, code, verifier); err != nil {
+				t.Fatal(err)
+			}
+			_, err := p.Exchange(ctx, code, verifier)
+			return err
+		}},
+		{"wrong client secret", func(t *testing.T, issuer *oidctest.Issuer, p *oidc.Provider) error {
+			code, verifier, _ := authorize(t, issuer, p)
+			p.ClientSecret = "guess"
+			_, err := p.Exchange(ctx, code, verifier)
+			return err
+		}},
+		{"nonce mismatch", func(t *testing.T, issuer *oidctest.Issuer, p *oidc.Provider) error {
+			code, verifier, _ := authorize(t, issuer, p)
+			raw, err := p.Exchange(ctx, code, verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = p.VerifyIDToken(ctx, raw, "other-nonce")
+			return err
+		}},
+		{"token for another client", func(t *testing.T, issuer *oidctest.Issuer, p *oidc.Provider) error {
+			code, verifier, nonce := authorize(t, issuer, p)
+			raw, err := p.Exchange(ctx, code, verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			other := oidc.NewProvider(issuer.URL(), "other", "", p.RedirectURL, p.Scopes)
+			_, err = other.VerifyIDToken(ctx, raw, nonce)
+			return err
+		}},
+		{"tampered token", func(t *testing.T, issuer *oidctest.Issuer, p *oidc.Provider) error {
+			code, verifier, nonce := authorize(t, issuer, p)
+			raw, err := p.Exchange(ctx, code, verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = p.VerifyIDToken(ctx, raw[:len(raw)-4]+"AAAA", nonce)
+			return err
+		}},
+		{"issuer mismatch", func(t *testing.T, issuer *oidctest.Issuer, p *oidc.Provider) error {
+			// same server, but not the issuer its discovery document names
+			wrong := oidc.NewProvider(strings.Replace(issuer.URL(), "127.0.0.1", "localhost", 1), "blog", "s3cret", p.RedirectURL, p.Scopes)
+			_, err := wrong.Discover(ctx)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := newTestIssuer(t)
+			p := oidc.NewProvider(issuer.URL(), "blog", "s3cret", "http://localhost:3000/oidc/callback", []string{"openid"})
+			if err := tt.run(t, issuer, p); err == nil {
+				t.Fatal("accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	miniosdk "github.com/minio/minio-go/v7"
+)
+
+// MinioStore keeps objects in a single bucket of a MinIO (or any S3
+// compatible) server.
+type MinioStore struct {
+	Client *miniosdk.Client
+	Bucket string
+}
+
+func NewMinioStore(client *miniosdk.Client, bucket string) *MinioStore {
+	return &MinioStore{Client: client, Bucket: bucket}
+}
+
+func (s *MinioStore) Ready(ctx context.Context) error {
+	exists, err := s.Client.BucketExists(ctx, s.Bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bucket %q does not exist", s.Bucket)
+	}
+
+	return nil
+}
+
+func (s *MinioStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (ObjectInfo, error) {
+	info, err := s.Client.PutObject(ctx, s.Bucket, key, r, size, miniosdk.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  contentType,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+func (s *MinioStore) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	obj, err := s.Client.GetObject(ctx, s.Bucket, key, miniosdk.GetObjectOptions{})
+	if err != nil {
+		return nil, ObjectInfo{}, convertMinioError(err)
+	}
+
+	return obj, info, nil
+}
+
+func (s *MinioStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := s.Client.StatObject(ctx, s.Bucket, key, miniosdk.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, convertMinioError(err)
+	}
+
+	return toObjectInfo(info), nil
+}
+
+func (s *MinioStore) Remove(ctx context.Context, key string) error {
+	return s.Client.RemoveObject(ctx, s.Bucket, key, miniosdk.RemoveObjectOptions{})
+}
+
+func (s *MinioStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	for info := range s.Client.ListObjects(ctx, s.Bucket, miniosdk.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, convertMinioError(info.Err)
+		}
+		objects = append(objects, toObjectInfo(info))
+	}
+
+	return objects, nil
+}
+
+func toObjectInfo(info miniosdk.ObjectInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		LastModified: info.LastModified,
+	}
+}
+
+func convertMinioError(err error) error {
+	if miniosdk.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
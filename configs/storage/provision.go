@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+
+	miniosdk "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+)
+
+const noncurrentRuleID = "expire-noncurrent-versions"
+
+type ProvisionOptions struct {
+	Region string
+	// PublicPrefixes can be read anonymously, everything else stays private
+	PublicPrefixes []string
+	// Versioning is "enabled", "suspended" or empty to leave it untouched
+	Versioning string
+	// NoncurrentDays expires overwritten/deleted versions after that many
+	// days, 0 leaves the lifecycle configuration untouched
+	NoncurrentDays int
+}
+
+// Provision makes the bucket match opts: it is created when missing, gets a
+// public-read policy on the media prefixes only and the requested
+// versioning/lifecycle settings. Every change is logged.
+func (s *MinioStore) Provision(ctx context.Context, opts ProvisionOptions) error {
+	exists, err := s.Client.BucketExists(ctx, s.Bucket)
+	if err != nil {
+		return fmt.Errorf("checking bucket %q: %w", s.Bucket, err)
+	}
+	if !exists {
+		if err := s.Client.MakeBucket(ctx, s.Bucket, miniosdk.MakeBucketOptions{Region: opts.Region}); err != nil {
+			return fmt.Errorf("creating bucket %q: %w", s.Bucket, err)
+		}
+		slog.Info("storage: created bucket", "bucket", s.Bucket)
+	}
+
+	if err := s.provisionPolicy(ctx, opts.PublicPrefixes); err != nil {
+		return err
+	}
+
+	if err := s.provisionVersioning(ctx, opts.Versioning); err != nil {
+		return err
+	}
+
+	return s.provisionLifecycle(ctx, opts.NoncurrentDays)
+}
+
+func (s *MinioStore) provisionPolicy(ctx context.Context, prefixes []string) error {
+	desired := publicReadPolicy(s.Bucket, prefixes)
+
+	current, err := s.Client.GetBucketPolicy(ctx, s.Bucket)
+	if err != nil {
+		return fmt.Errorf("reading policy of bucket %q: %w", s.Bucket, err)
+	}
+
+	if samePolicy(current, desired) {
+		slog.Info("storage: bucket policy up to date", "bucket", s.Bucket)
+		return nil
+	}
+
+	// an empty policy removes it, making the whole bucket private
+	if err := s.Client.SetBucketPolicy(ctx, s.Bucket, desired); err != nil {
+		return fmt.Errorf("setting policy of bucket %q: %w", s.Bucket, err)
+	}
+
+	if desired == "" {
+		slog.Info("storage: bucket policy removed, bucket is private", "bucket", s.Bucket)
+	} else {
+		slog.Info("storage: bucket policy set", "bucket", s.Bucket, "public_prefixes", prefixes)
+	}
+	return nil
+}
+
+func (s *MinioStore) provisionVersioning(ctx context.Context, versioning string) error {
+	current, err := s.Client.GetBucketVersioning(ctx, s.Bucket)
+	if err != nil {
+		return fmt.Errorf("reading versioning of bucket %q: %w", s.Bucket, err)
+	}
+
+	switch versioning {
+	case "":
+		slog.Info("storage: bucket versioning left untouched", "bucket", s.Bucket, "versioning", current.Status)
+		return nil
+	case "enabled":
+		if current.Enabled() {
+			return nil
+		}
+		err = s.Client.EnableVersioning(ctx, s.Bucket)
+	case "suspended":
+		if !current.Enabled() {
+			return nil
+		}
+		err = s.Client.SuspendVersioning(ctx, s.Bucket)
+	default:
+		return fmt.Errorf("unknown versioning setting %q", versioning)
+	}
+	if err != nil {
+		return fmt.Errorf("setting versioning of bucket %q: %w", s.Bucket, err)
+	}
+
+	slog.Info("storage: bucket versioning changed", "bucket", s.Bucket, "from", current.Status, "to", versioning)
+	return nil
+}
+
+func (s *MinioStore) provisionLifecycle(ctx context.Context, noncurrentDays int) error {
+	current, err := s.Client.GetBucketLifecycle(ctx, s.Bucket)
+	if err != nil {
+		if miniosdk.ToErrorResponse(err).Code != "NoSuchLifecycleConfiguration" {
+			return fmt.Errorf("reading lifecycle of bucket %q: %w", s.Bucket, err)
+		}
+		current = lifecycle.NewConfiguration()
+	}
+
+	if noncurrentDays == 0 {
+		slog.Info("storage: bucket lifecycle left untouched", "bucket", s.Bucket, "rules", len(current.Rules))
+		return nil
+	}
+
+	rule := lifecycle.Rule{
+		ID:     noncurrentRuleID,
+		Status: "Enabled",
+		NoncurrentVersionExpiration: lifecycle.NoncurrentVersionExpiration{
+			NoncurrentDays: lifecycle.ExpirationDays(noncurrentDays),
+		},
+	}
+
+	// keep every rule we don't own, replace ours
+	rules := []lifecycle.Rule{}
+	for _, r := range current.Rules {
+		if r.ID == noncurrentRuleID {
+			if r.Status == rule.Status && r.NoncurrentVersionExpiration.NoncurrentDays == rule.NoncurrentVersionExpiration.NoncurrentDays {
+				return nil
+			}
+			continue
+		}
+		rules = append(rules, r)
+	}
+	current.Rules = append(rules, rule)
+
+	if err := s.Client.SetBucketLifecycle(ctx, s.Bucket, current); err != nil {
+		return fmt.Errorf("setting lifecycle of bucket %q: %w", s.Bucket, err)
+	}
+
+	slog.Info("storage: bucket now expires noncurrent versions", "bucket", s.Bucket, "days", noncurrentDays)
+	return nil
+}
+
+// publicReadPolicy grants anonymous s3:GetObject on the given prefixes only,
+// no prefixes means no policy at all
+func publicReadPolicy(bucket string, prefixes []string) string {
+	if len(prefixes) == 0 {
+		return ""
+	}
+
+	resources := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		resources[i] = fmt.Sprintf("arn:aws:s3:::%s/%s*", bucket, prefix)
+	}
+
+	policy, _ := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{{
+			"Effect":    "Allow",
+			"Principal": map[string]interface{}{"AWS": []string{"*"}},
+			"Action":    []string{"s3:GetObject"},
+			"Resource":  resources,
+		}},
+	})
+	return string(policy)
+}
+
+// samePolicy compares two policy documents ignoring formatting
+func samePolicy(a, b string) bool {
+	if a == "" || b == "" {
+		return a == b
+	}
+
+	var da, db interface{}
+	if json.Unmarshal([]byte(a), &da) != nil || json.Unmarshal([]byte(b), &db) != nil {
+		return false
+	}
+	return reflect.DeepEqual(da, db)
+}
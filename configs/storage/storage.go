@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("object not found")
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ObjectStore is where uploaded media (blog thumbnails, profile pictures)
+// lives. Keys are slash separated, e.g. "blog/1662000000.png".
+type ObjectStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (ObjectInfo, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Remove deletes the object, removing a missing object is not an error
+	Remove(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// CleanKey checks that key is a plain relative key, without empty, "." or
+// ".." segments or backslashes, so prefix checks on it can be trusted
+func CleanKey(key string) (string, error) {
+	if key == "" || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", ErrInvalidKey
+		}
+	}
+	return key, nil
+}
+
+// readier is implemented by backends that can cheaply tell whether their
+// underlying location (bucket, directory) exists
+type readier interface {
+	Ready(ctx context.Context) error
+}
+
+// probeKey is written and removed again by CheckWritable
+const probeKey = ".health/probe"
+
+// CheckWritable verifies the store is reachable and accepts writes by
+// writing and removing a tiny probe object
+func CheckWritable(ctx context.Context, objects ObjectStore) error {
+	if r, ok := objects.(readier); ok {
+		if err := r.Ready(ctx); err != nil {
+			return err
+		}
+	}
+
+	body := []byte("ok")
+	if _, err := objects.Put(ctx, probeKey, bytes.NewReader(body), int64(len(body)), "text/plain"); err != nil {
+		return fmt.Errorf("write probe: %w", err)
+	}
+
+	if err := objects.Remove(ctx, probeKey); err != nil {
+		return fmt.Errorf("remove probe: %w", err)
+	}
+
+	return nil
+}
+
+// WriteProbe runs CheckWritable at most once per TTL and answers with the
+// last result in between, so frequent readiness checks don't each cost a
+// write. Concurrent checks wait for the one in flight.
+type WriteProbe struct {
+	Objects ObjectStore
+	Timeout time.Duration
+	TTL     time.Duration
+
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+func NewWriteProbe(objects ObjectStore) *WriteProbe {
+	return &WriteProbe{Objects: objects, Timeout: 5 * time.Second, TTL: 10 * time.Second}
+}
+
+func (p *WriteProbe) Check(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.checked.IsZero() && time.Since(p.checked) < p.TTL {
+		return p.err
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+	err := CheckWritable(probeCtx, p.Objects)
+
+	// a caller that went away says nothing about the store
+	if ctx.Err() == nil {
+		p.checked, p.err = time.Now(), err
+	}
+	return err
+}
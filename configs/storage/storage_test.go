@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCleanKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{"blog/a.png", false},
+		{"profile/2024/me.jpg", false},
+		{"a..b/c", false},
+		{"", true},
+		{"blog/../private/secret.txt", true},
+		{"../etc/passwd", true},
+		{"blog/./a.png", true},
+		{"blog//a.png", true},
+		{"/blog/a.png", true},
+		{"blog/", true},
+		{"blog\\..\\secret", true},
+		{"..", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := CleanKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CleanKey(%q) = %q, %v", tt.key, got, err)
+			}
+			if err == nil && got != tt.key {
+				t.Fatalf("CleanKey(%q) = %q", tt.key, got)
+			}
+		})
+	}
+}
+
+func TestFileStoreKeys(t *testing.T) {
+	ctx := context.Background()
+	objects, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := objects.Put(ctx, "blog/a.png", strings.NewReader("png"), 3, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := objects.Stat(ctx, "blog/a.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing outside the root is reachable, whatever the operation
+	for _, key := range []string{"../outside", "blog/../../outside", "blog//a.png"} {
+		if _, err := objects.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if _, _, err := objects.Get(ctx, key); err == nil {
+			t.Errorf("Get(%q) succeeded", key)
+		}
+		if err := objects.Remove(ctx, key); err == nil {
+			t.Errorf("Remove(%q) succeeded", key)
+		}
+	}
+}
+
+// readOnlyStore refuses writes, like a bucket without write permission
+type readOnlyStore struct {
+	ObjectStore
+	puts int
+}
+
+func (s *readOnlyStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (ObjectInfo, error) {
+	s.puts++
+	return ObjectInfo{}, errors.New("access denied")
+}
+
+func TestCheckWritable(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	objects, err := NewFileStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckWritable(ctx, objects); err != nil {
+		t.Fatal(err)
+	}
+	if infos, err := objects.List(ctx, ""); err != nil || len(infos) != 0 {
+		t.Fatalf("probe left %v, %v", infos, err)
+	}
+
+	if err := CheckWritable(ctx, &readOnlyStore{ObjectStore: objects}); err == nil {
+		t.Fatal("read-only store reported writable")
+	}
+
+	objects.Root = filepath.Join(root, "missing")
+	if err := CheckWritable(ctx, objects); err == nil {
+		t.Fatal("missing root reported writable")
+	}
+}
+
+func TestWriteProbeCaches(t *testing.T) {
+	objects, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &readOnlyStore{ObjectStore: objects}
+	probe := NewWriteProbe(store)
+
+	for i := 0; i < 3; i++ {
+		if err := probe.Check(context.Background()); err == nil {
+			t.Fatal("read-only store reported writable")
+		}
+	}
+	if store.puts != 1 {
+		t.Fatalf("%d writes within the ttl, want 1", store.puts)
+	}
+
+	probe.TTL = 0
+	probe.Check(context.Background())
+	if store.puts != 2 {
+		t.Fatalf("%d writes after the ttl, want 2", store.puts)
+	}
+
+	// a cancelled caller isn't remembered
+	probe.TTL = time.Hour
+	probe.checked = time.Time{}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	probe.Check(cancelled)
+	probe.Check(context.Background())
+	if store.puts != 4 {
+		t.Fatalf("%d writes, want 4", store.puts)
+	}
+}
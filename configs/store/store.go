@@ -0,0 +1,54 @@
+package store
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	ErrNotFound  = errors.New("document not found")
+	ErrDuplicate = errors.New("document already exists")
+)
+
+// ApplySet mimics a mongo "$set" on an in-memory document. The document is
+// round-tripped through bson so the same field names and omitempty rules
+// used by the mongo stores apply here too.
+func ApplySet(doc interface{}, set bson.M) error {
+	pByte, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	var current bson.M
+	if err := bson.Unmarshal(pByte, &current); err != nil {
+		return err
+	}
+
+	for k, v := range set {
+		current[k] = v
+	}
+
+	pByte, err = bson.Marshal(current)
+	if err != nil {
+		return err
+	}
+
+	return bson.Unmarshal(pByte, doc)
+}
+
+// ToSet converts a struct into a bson.M suitable for "$set", dropping every
+// field tagged omitempty that holds its zero value.
+func ToSet(doc interface{}) (bson.M, error) {
+	pByte, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var update bson.M
+	if err := bson.Unmarshal(pByte, &update); err != nil {
+		return nil, err
+	}
+
+	return update, nil
+}
@@ -0,0 +1,110 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Claims are the registered and private claims of access and challenge
+// tokens. Subject is the user id, SessionId the login the token belongs to
+// and Method, on challenges only, how that login started.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Username  string   `json:"username,omitempty"`
+	Role      string   `json:"role,omitempty"`
+	SessionId string   `json:"sid,omitempty"`
+	Method    string   `json:"auth_method,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	Issuer    string   `json:"iss"`
+	Audience  Audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat"`
+}
+
+var (
+	ErrNoSubject     = errors.New("token has no subject")
+	ErrExpired       = errors.New("token has no expiry or is expired")
+	ErrNotYetValid   = errors.New("token is not valid yet")
+	ErrIssuedAt      = errors.New("token has no issue time or is issued in the future")
+	ErrWrongIssuer   = errors.New("token has the wrong issuer")
+	ErrWrongAudience = errors.New("token has the wrong audience")
+)
+
+// Valid makes Claims a jwt.Claims. It only checks the times, without
+// leeway; Validate is what the Issuer runs.
+func (c Claims) Valid() error {
+	return c.validTimes(time.Now(), 0)
+}
+
+// Validate checks every claim a token must carry. Times are compared with
+// leeway either way, for servers whose clocks disagree a little.
+func (c Claims) Validate(issuer, audience string, now time.Time, leeway time.Duration) error {
+	if c.Subject == "" {
+		return ErrNoSubject
+	}
+	if err := c.validTimes(now, leeway); err != nil {
+		return err
+	}
+	if c.Issuer != issuer {
+		return ErrWrongIssuer
+	}
+	if !c.Audience.Contains(audience) {
+		return ErrWrongAudience
+	}
+	return nil
+}
+
+func (c Claims) validTimes(now time.Time, leeway time.Duration) error {
+	late := now.Add(-leeway).Unix()
+	early := now.Add(leeway).Unix()
+
+	// exp is the first second the token is no longer accepted
+	if c.ExpiresAt == 0 || late >= c.ExpiresAt {
+		return ErrExpired
+	}
+	if c.NotBefore != 0 && early < c.NotBefore {
+		return ErrNotYetValid
+	}
+	// revocations compare against iat, a token without one can't be revoked
+	if c.IssuedAt == 0 || early < c.IssuedAt {
+		return ErrIssuedAt
+	}
+	return nil
+}
+
+// Audience is the aud claim, a single string or a list (RFC 7519 4.1.3)
+type Audience []string
+
+func (a Audience) Contains(audience string) bool {
+	for _, aud := range a {
+		if aud == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON writes a lone audience as a plain string, as most issuers do
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("aud must be a string or a list of strings")
+	}
+	*a = list
+	return nil
+}
@@ -0,0 +1,107 @@
+package token
+
+import (
+	"time"
+)
+
+// Issuer mints the short lived access tokens handed out by /login and
+// /token/refresh and checks the ones presented to user.Auth
+type Issuer struct {
+	Keys     *Keyring
+	Issuer   string
+	Audience string
+	TTL      time.Duration
+	// Leeway is the clock difference tolerated on exp, nbf and iat
+	Leeway time.Duration
+}
+
+func NewIssuer(keys *Keyring, issuer, audience string, ttl, leeway time.Duration) *Issuer {
+	return &Issuer{Keys: keys, Issuer: issuer, Audience: audience, TTL: ttl, Leeway: leeway}
+}
+
+// Issue returns a signed access token for the user in session sessionId and
+// when it expires
+func (i *Issuer) Issue(userId, username, role, sessionId string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(i.TTL)
+
+	jti, _, err := NewOpaque()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	claims := Claims{
+		Subject:   userId,
+		Username:  username,
+		Role:      role,
+		SessionId: sessionId,
+		ID:        jti,
+		Issuer:    i.Issuer,
+		Audience:  Audience{i.Audience},
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	}
+
+	signed, err := i.Keys.Sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// Verify checks signature, times, issuer and audience of an access token
+func (i *Issuer) Verify(tokenString string) (Claims, error) {
+	return i.verify(tokenString, i.Audience)
+}
+
+func (i *Issuer) verify(tokenString, audience string) (Claims, error) {
+	var claims Claims
+	if _, err := i.Keys.Parse(tokenString, &claims); err != nil {
+		return Claims{}, err
+	}
+
+	if err := claims.Validate(i.Issuer, audience, time.Now(), i.Leeway); err != nil {
+		return Claims{}, err
+	}
+	return claims, nil
+}
+
+// challengeAudience sets challenge tokens apart, Verify rejects them as
+// access tokens
+func (i *Issuer) challengeAudience() string {
+	return i.Audience + "/2fa"
+}
+
+// IssueChallenge returns a token proving the first factor of userId was
+// checked by method, to be traded for an access token once the second factor
+// is checked too
+func (i *Issuer) IssueChallenge(userId, method string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	claims := Claims{
+		Subject:   userId,
+		Method:    method,
+		Issuer:    i.Issuer,
+		Audience:  Audience{i.challengeAudience()},
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	}
+
+	signed, err := i.Keys.Sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// VerifyChallenge checks a token from IssueChallenge and returns its user id
+// and method
+func (i *Issuer) VerifyChallenge(tokenString string) (string, string, error) {
+	claims, err := i.verify(tokenString, i.challengeAudience())
+	if err != nil {
+		return "", "", err
+	}
+	return claims.Subject, claims.Method, nil
+}
@@ -0,0 +1,170 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+
+	"fadel-blog-services/configs/jwk"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// shorter rsa keys are refused, NIST SP 800-57
+const minRSABits = 2048
+
+// Key is one signing key, its ID goes into the "kid" header of every token
+// it signs so the verifier knows which key to check against
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// SignKey signs new tokens, VerifyKey checks them. They are the same
+	// secret for HMAC keys. A key loaded from a public key pem only verifies,
+	// SignKey is nil then.
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
+func NewHMACKey(id string, secret []byte) Key {
+	return Key{ID: id, Method: jwt.SigningMethodHS256, SignKey: secret, VerifyKey: secret}
+}
+
+// ParsePEMKey reads an RSA (RS256) or Ed25519 (EdDSA) key. Private keys may
+// be PKCS#1 or PKCS#8, a PKIX public key gives a verify-only key.
+func ParsePEMKey(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, errors.New("no pem block found")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return Key{}, fmt.Errorf("unsupported pem block %q", block.Type)
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < minRSABits {
+			return Key{}, fmt.Errorf("rsa key must be at least %d bits", minRSABits)
+		}
+		return Key{ID: id, Method: jwt.SigningMethodRS256, SignKey: key, VerifyKey: &key.PublicKey}, nil
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSABits {
+			return Key{}, fmt.Errorf("rsa key must be at least %d bits", minRSABits)
+		}
+		return Key{ID: id, Method: jwt.SigningMethodRS256, VerifyKey: key}, nil
+	case ed25519.PrivateKey:
+		return Key{ID: id, Method: jwt.SigningMethodEdDSA, SignKey: key, VerifyKey: key.Public()}, nil
+	case ed25519.PublicKey:
+		return Key{ID: id, Method: jwt.SigningMethodEdDSA, VerifyKey: key}, nil
+	}
+
+	return Key{}, fmt.Errorf("unsupported key type %T, use rsa or ed25519", key)
+}
+
+// Keyring signs with the active key and verifies with any key it holds.
+// Rotating means adding the new key, making it active and dropping the old
+// one once every token it signed has expired.
+type Keyring struct {
+	active string
+	keys   map[string]Key
+}
+
+var ErrUnknownKey = errors.New("token signed with an unknown key")
+
+func NewKeyring(active string, keys ...Key) (*Keyring, error) {
+	k := &Keyring{active: active, keys: map[string]Key{}}
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("key without id")
+		}
+		if _, ok := k.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		k.keys[key.ID] = key
+	}
+
+	if key, ok := k.keys[active]; !ok {
+		return nil, fmt.Errorf("active key %q is not in the keyring", active)
+	} else if key.SignKey == nil {
+		return nil, fmt.Errorf("active key %q has no private key", active)
+	}
+
+	return k, nil
+}
+
+// ActiveID is the kid new tokens are signed with
+func (k *Keyring) ActiveID() string {
+	return k.active
+}
+
+// IDs lists every key id, sorted
+func (k *Keyring) IDs() []string {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// PublicKeys lists the asymmetric keys for the jwks endpoint, sorted by id.
+// HMAC secrets are never published.
+func (k *Keyring) PublicKeys() jwk.Set {
+	set := jwk.Set{Keys: []jwk.Key{}}
+	for _, id := range k.IDs() {
+		key := k.keys[id]
+		if _, ok := key.Method.(*jwt.SigningMethodHMAC); ok {
+			continue
+		}
+		if public, err := jwk.New(key.ID, key.Method.Alg(), key.VerifyKey); err == nil {
+			set.Keys = append(set.Keys, public)
+		}
+	}
+	return set
+}
+
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	key := k.keys[k.active]
+
+	t := jwt.NewWithClaims(key.Method, claims)
+	t.Header["kid"] = key.ID
+	return t.SignedString(key.SignKey)
+}
+
+// Parse verifies tokenString with the key named by its kid header and
+// decodes the claims into claims. Checking the claims is up to the caller.
+func (k *Keyring) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	return parser.ParseWithClaims(tokenString, claims, k.keyFunc)
+}
+
+func (k *Keyring) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	// never let the token pick the algorithm
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+
+	return key.VerifyKey, nil
+}
@@ -0,0 +1,113 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func ed25519PEM(t *testing.T) (private, public []byte) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDer, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer})
+}
+
+func TestKeyringEdDSA(t *testing.T) {
+	private, public := ed25519PEM(t)
+	signing, err := ParsePEMKey("ed-1", private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signing.Method.Alg() != "EdDSA" {
+		t.Fatalf("alg %q", signing.Method.Alg())
+	}
+	verifying, err := ParsePEMKey("ed-1", public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := ed25519PEM(t)
+	otherKey, err := ParsePEMKey("ed-1", other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmac := NewHMACKey("hs-1", []byte("0123456789abcdef0123456789abcdef"))
+
+	signer, err := NewKeyring("ed-1", signing, hmac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := signer.Sign(jwt.MapClaims{"sub": "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacSigner, err := NewKeyring("hs-1", hmac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacSigned, err := hmacSigner.Sign(jwt.MapClaims{"sub": "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewKeyring("ed-1", verifying); err == nil {
+		t.Fatal("verify-only key accepted as the active key")
+	}
+	verifier, err := NewKeyring("hs-1", hmac, verifying)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongKey, err := NewKeyring("ed-1", otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edOnly, err := NewKeyring("ed-1", signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		token   string
+		wantErr bool
+	}{
+		{"signing keyring", signer, signed, false},
+		{"public key verifies", verifier, signed, false},
+		{"hmac next to eddsa", verifier, hmacSigned, false},
+		{"other ed25519 key", wrongKey, signed, true},
+		{"unknown kid", edOnly, hmacSigned, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{}
+			_, err := tt.keyring.Parse(tt.token, claims)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && claims["sub"] != "u1" {
+				t.Fatalf("claims %v", claims)
+			}
+		})
+	}
+
+	if _, err := edOnly.Parse(hmacSigned, jwt.MapClaims{}); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("err = %v, want ErrUnknownKey", err)
+	}
+}
@@ -0,0 +1,27 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// NewOpaque returns a random token for the client and the hash to store,
+// the plain value is never persisted
+func NewOpaque() (plain string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	plain = base64.RawURLEncoding.EncodeToString(b)
+	return plain, HashOpaque(plain), nil
+}
+
+// HashOpaque is the lookup key of an opaque token. The tokens carry 256
+// bits of randomness so a fast unsalted hash is enough.
+func HashOpaque(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,32 +1,35 @@
 package blog
 
 import (
-	"context"
 	"fmt"
 	"net/http"
+	"path"
 	"path/filepath"
+	"strings"
 	"time"
 
-	"fadel-blog-services/configs/db"
 	"fadel-blog-services/configs/helpers"
-	"fadel-blog-services/configs/minio"
+	"fadel-blog-services/configs/storage"
+	"fadel-blog-services/configs/store"
+	"fadel-blog-services/controllers/user"
 
 	"github.com/gin-gonic/gin"
-	miniosdk "github.com/minio/minio-go/v7"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
-var blogColl = db.DB.Collection("blog")
+type Controller struct {
+	Blogs   BlogStore
+	Users   user.UserStore
+	Objects storage.ObjectStore
+}
 
-func GetBlogs(c *gin.Context) {
-	cursor, err := blogColl.Find(context.Background(), bson.M{})
-	if err != nil {
-		helpers.SendInternalServerError(c, err)
-		return
-	}
+func NewController(blogs BlogStore, users user.UserStore, objects storage.ObjectStore) *Controller {
+	return &Controller{Blogs: blogs, Users: users, Objects: objects}
+}
 
-	blogs := []Blog{}
-	if err = cursor.All(db.Ctx, &blogs); err != nil {
+func (ctl *Controller) GetBlogs(c *gin.Context) {
+	blogs, err := ctl.Blogs.FindAll(c.Request.Context())
+	if err != nil {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
@@ -37,11 +40,15 @@ func GetBlogs(c *gin.Context) {
 	})
 }
 
-func GetBlogBySlug(c *gin.Context) {
+func (ctl *Controller) GetBlogBySlug(c *gin.Context) {
 	blogSlug := c.Param("slug")
-	var blog Blog
 
-	if err := blogColl.FindOne(context.Background(), bson.M{"slug": blogSlug}).Decode(&blog); err != nil {
+	blog, err := ctl.Blogs.FindBySlug(c.Request.Context(), blogSlug)
+	if err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusNotFound, "blog not found")
+			return
+		}
 		helpers.SendInternalServerError(c, err)
 		return
 	}
@@ -52,28 +59,20 @@ func GetBlogBySlug(c *gin.Context) {
 	})
 }
 
-func AddBlog(c *gin.Context) {
-	user, _ := c.Get("user")
+func (ctl *Controller) AddBlog(c *gin.Context) {
+	caller := user.MustPrincipal(c)
 
 	var blogData Blog
 
 	if err := c.Bind(&blogData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "failed",
-			"message": "can't bind struct",
-		})
-		c.Abort()
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
 		return
 	}
 
-	// get thumbnail and upload it to minio
+	// get thumbnail and upload it to object storage
 	fileHeader, err := c.FormFile("image_url")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "failed",
-			"message": err.Error(),
-		})
-		c.Abort()
+		helpers.SendFailed(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -89,11 +88,13 @@ func AddBlog(c *gin.Context) {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
+	defer file.Close()
 
-	// upload to minio
-	objectName := fmt.Sprint(time.Now().UnixNano()) + filepath.Ext(fileHeader.Filename)
+	// upload to object storage
+	contentType, _ := helpers.ImageContentType(fileHeader.Filename)
+	objectName := fmt.Sprint(time.Now().UnixNano()) + strings.ToLower(filepath.Ext(fileHeader.Filename))
 
-	_, err = minio.MinioClient.PutObject(context.Background(), "fadel-blog", "blog/"+objectName, file, fileHeader.Size, miniosdk.PutObjectOptions{})
+	_, err = ctl.Objects.Put(c.Request.Context(), "blog/"+objectName, file, fileHeader.Size, contentType)
 	if err != nil {
 		helpers.SendInternalServerError(c, err)
 		return
@@ -106,22 +107,33 @@ func AddBlog(c *gin.Context) {
 		return
 	}
 
-	slug := helpers.CreateSlug(blogData.Title)
-	newBlog := bson.M{
-		"blog_id":    newBlogId,
-		"title":      blogData.Title,
-		"body":       blogData.Body,
-		"image_url":  objectName,
-		"image_alt":  blogData.ImageAlt,
-		"slug":       slug,
-		"published":  "no",
-		"created_at": time.Now(),
-		"updated_at": time.Now(),
-		"updated_by": user.(map[string]string)["user_id"],
+	// slug is unique, posts sharing a title get a numbered suffix
+	slug, err := UniqueSlug(c.Request.Context(), ctl.Blogs, helpers.CreateSlug(blogData.Title), "")
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
 	}
 
-	_, err = blogColl.InsertOne(context.Background(), newBlog)
-	if err != nil {
+	newBlog := Blog{
+		BlogId:    newBlogId,
+		Title:     blogData.Title,
+		Body:      blogData.Body,
+		ImageURL:  objectName,
+		ImageAlt:  blogData.ImageAlt,
+		Slug:      slug,
+		Published: "no",
+		AuthorId:  caller.UserId,
+		CreatedBy: caller.UserId,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UpdatedBy: caller.UserId,
+	}
+
+	if err = ctl.Blogs.Insert(c.Request.Context(), newBlog); err != nil {
+		if err == store.ErrDuplicate {
+			helpers.SendFailed(c, http.StatusConflict, "a blog with the same slug was just created, please retry")
+			return
+		}
 		helpers.SendInternalServerError(c, err)
 		return
 	}
@@ -132,44 +144,51 @@ func AddBlog(c *gin.Context) {
 	})
 }
 
-func EditBlogById(c *gin.Context) {
-	user, _ := c.Get("user")
+func (ctl *Controller) EditBlogById(c *gin.Context) {
+	caller := user.MustPrincipal(c)
 	blogId := c.Param("id")
-	var blogData Blog
+	var body EditBlogRequest
 
-	if err := c.BindJSON(&blogData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "failed",
-			"message": "can't bind struct",
-		})
-		c.Abort()
+	if err := c.BindJSON(&body); err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
 		return
 	}
 
-	// update updated_at, updated_by
-	blogData.UpdatedAt = time.Now()
-	blogData.UpdatedBy = user.(map[string]string)["user_id"]
-
-	// update process
-	pByte, err := bson.Marshal(blogData)
-	if err != nil {
-		helpers.SendInternalServerError(c, err)
+	if _, ok := ctl.findOwnedBlog(c, blogId); !ok {
 		return
 	}
 
-	var update bson.M
-	err = bson.Unmarshal(pByte, &update)
-	if err != nil {
-		helpers.SendInternalServerError(c, err)
-		return
+	update := bson.M{
+		"updated_at": time.Now(),
+		"updated_by": caller.UserId,
 	}
+	if body.Title != nil {
+		if *body.Title == "" {
+			helpers.SendFailed(c, http.StatusBadRequest, "title can't be empty")
+			return
+		}
 
-	_, err = blogColl.UpdateOne(
-		context.Background(),
-		bson.M{"blog_id": blogId},
-		bson.M{"$set": update},
-	)
-	if err != nil {
+		// the slug follows the title, unique like on AddBlog
+		slug, err := UniqueSlug(c.Request.Context(), ctl.Blogs, helpers.CreateSlug(*body.Title), blogId)
+		if err != nil {
+			helpers.SendInternalServerError(c, err)
+			return
+		}
+		update["title"] = *body.Title
+		update["slug"] = slug
+	}
+	if body.Body != nil {
+		update["body"] = *body.Body
+	}
+	if body.ImageAlt != nil {
+		update["image_alt"] = *body.ImageAlt
+	}
+
+	if err := ctl.Blogs.Update(c.Request.Context(), blogId, update); err != nil {
+		if err == store.ErrDuplicate {
+			helpers.SendFailed(c, http.StatusConflict, "a blog with the same slug was just created, please retry")
+			return
+		}
 		helpers.SendInternalServerError(c, err)
 		return
 	}
@@ -180,26 +199,25 @@ func EditBlogById(c *gin.Context) {
 	})
 }
 
-func DeleteBlogById(c *gin.Context) {
+func (ctl *Controller) DeleteBlogById(c *gin.Context) {
 	blogId := c.Param("id")
 
 	// get blog data
-	var deletedBlogData Blog
-	if err := blogColl.FindOne(context.Background(), bson.M{"blog_id": blogId}).Decode(&deletedBlogData); err != nil {
-		helpers.SendInternalServerError(c, err)
+	deletedBlogData, ok := ctl.findOwnedBlog(c, blogId)
+	if !ok {
 		return
 	}
 
-	// delete blog thumbnail in minio based on image_url (object name)
-	err := minio.MinioClient.RemoveObject(context.Background(), "fadel-blog", "blog/"+deletedBlogData.ImageURL, miniosdk.RemoveObjectOptions{})
-	if err != nil {
-		helpers.SendInternalServerError(c, err)
-		return
+	// delete blog thumbnail in object storage based on image_url (object name)
+	if key, ok := thumbnailKey(deletedBlogData.ImageURL); ok {
+		if err := ctl.Objects.Remove(c.Request.Context(), key); err != nil {
+			helpers.SendInternalServerError(c, err)
+			return
+		}
 	}
 
 	// delete blog document in mongodb based on id
-	_, err = blogColl.DeleteOne(context.Background(), bson.M{"blog_id": blogId})
-	if err != nil {
+	if err := ctl.Blogs.Delete(c.Request.Context(), blogId); err != nil {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
@@ -210,17 +228,22 @@ func DeleteBlogById(c *gin.Context) {
 	})
 }
 
-func UpdateBlogThumbnail(c *gin.Context) {
+func (ctl *Controller) UpdateBlogThumbnail(c *gin.Context) {
 	blogId := c.Param("id")
-	user, _ := c.Get("user")
+	caller := user.MustPrincipal(c)
+
+	// 1. get updated blog so we could get the old thumbnail
+	// 2. delete the old thumbnail from object storage (if exists)
+
+	// 1
+	updatedBlog, ok := ctl.findOwnedBlog(c, blogId)
+	if !ok {
+		return
+	}
 
 	fileHeader, err := c.FormFile("image_url")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "failed",
-			"message": err.Error(),
-		})
-		c.Abort()
+		helpers.SendFailed(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -236,29 +259,20 @@ func UpdateBlogThumbnail(c *gin.Context) {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
+	defer file.Close()
 
-	// upload to minio
-	objectName := fmt.Sprint(time.Now().UnixNano()) + filepath.Ext(fileHeader.Filename)
-	info, err := minio.MinioClient.PutObject(context.Background(), "fadel-blog", "blog/"+objectName, file, fileHeader.Size, miniosdk.PutObjectOptions{})
+	// upload to object storage
+	contentType, _ := helpers.ImageContentType(fileHeader.Filename)
+	objectName := fmt.Sprint(time.Now().UnixNano()) + strings.ToLower(filepath.Ext(fileHeader.Filename))
+	info, err := ctl.Objects.Put(c.Request.Context(), "blog/"+objectName, file, fileHeader.Size, contentType)
 	if err != nil {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
 
-	// 1. get updated blog so we could get the old thumbnail
-	// 2. delete the old thumbnail from minio (if exists)
-
-	// 1
-	var updatedBlog Blog
-	if err := blogColl.FindOne(context.Background(), bson.M{"blog_id": blogId}).Decode(&updatedBlog); err != nil {
-		helpers.SendInternalServerError(c, err)
-		return
-	}
-
 	// 2
-	blogThumbnail := updatedBlog.ImageURL
-	if blogThumbnail != "" {
-		err := minio.MinioClient.RemoveObject(context.Background(), "fadel-blog", "blog/"+blogThumbnail, miniosdk.RemoveObjectOptions{})
+	if key, ok := thumbnailKey(updatedBlog.ImageURL); ok {
+		err := ctl.Objects.Remove(c.Request.Context(), key)
 		if err != nil {
 			helpers.SendInternalServerError(c, err)
 			return
@@ -271,28 +285,16 @@ func UpdateBlogThumbnail(c *gin.Context) {
 	// add updated_at, updated_by, and image url (thumbnail)
 	updatedBlogData.ImageURL = objectName
 	updatedBlogData.UpdatedAt = time.Now()
-	updatedBlogData.UpdatedBy = user.(map[string]string)["user_id"]
+	updatedBlogData.UpdatedBy = caller.UserId
 
 	// update process
-	pByte, err := bson.Marshal(updatedBlogData)
-	if err != nil {
-		helpers.SendInternalServerError(c, err)
-		return
-	}
-
-	var update bson.M
-	err = bson.Unmarshal(pByte, &update)
+	update, err := store.ToSet(updatedBlogData)
 	if err != nil {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
 
-	_, err = blogColl.UpdateOne(
-		context.Background(),
-		bson.M{"blog_id": blogId},
-		bson.M{"$set": update},
-	)
-	if err != nil {
+	if err = ctl.Blogs.Update(c.Request.Context(), blogId, update); err != nil {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
@@ -303,15 +305,24 @@ func UpdateBlogThumbnail(c *gin.Context) {
 	})
 }
 
-func PublishBlogById(c *gin.Context) {
+// thumbnailKey is the object key of a blog's image_url. Only plain object
+// names under blog/ count, anything else was never uploaded by AddBlog or
+// UpdateBlogThumbnail and must not be removed.
+func thumbnailKey(imageURL string) (string, bool) {
+	if imageURL == "" || imageURL != path.Base(imageURL) || imageURL == "." || imageURL == ".." {
+		return "", false
+	}
+	return "blog/" + imageURL, true
+}
+
+func (ctl *Controller) PublishBlogById(c *gin.Context) {
 	blogId := c.Param("id")
-	user, _ := c.Get("user")
+	caller := user.MustPrincipal(c)
 
-	var oldBlogData Blog
 	var blogData Blog
 
-	if err := blogColl.FindOne(context.Background(), bson.M{"blog_id": blogId}).Decode(&oldBlogData); err != nil {
-		helpers.SendInternalServerError(c, err)
+	oldBlogData, ok := ctl.findOwnedBlog(c, blogId)
+	if !ok {
 		return
 	}
 
@@ -321,29 +332,17 @@ func PublishBlogById(c *gin.Context) {
 	} else {
 		blogData.Published = "yes"
 	}
-	blogData.UpdatedBy = user.(map[string]string)["user_id"]
+	blogData.UpdatedBy = caller.UserId
 	blogData.UpdatedAt = time.Now()
 
 	// update process
-	pByte, err := bson.Marshal(blogData)
+	update, err := store.ToSet(blogData)
 	if err != nil {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
 
-	var update bson.M
-	err = bson.Unmarshal(pByte, &update)
-	if err != nil {
-		helpers.SendInternalServerError(c, err)
-		return
-	}
-
-	_, err = blogColl.UpdateOne(
-		context.Background(),
-		bson.M{"blog_id": blogId},
-		bson.M{"$set": update},
-	)
-	if err != nil {
+	if err = ctl.Blogs.Update(c.Request.Context(), blogId, update); err != nil {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
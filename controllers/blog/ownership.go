@@ -0,0 +1,93 @@
+package blog
+
+import (
+	"net/http"
+	"time"
+
+	"fadel-blog-services/configs/helpers"
+	"fadel-blog-services/configs/logger"
+	"fadel-blog-services/configs/store"
+	"fadel-blog-services/controllers/user"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type TransferRequest struct {
+	AuthorId string `json:"author_id" binding:"required"`
+}
+
+// findOwnedBlog loads the blog and makes sure the caller may modify it:
+// authors and contributors only their own posts, editors and admins any.
+// On failure the response is already sent.
+func (ctl *Controller) findOwnedBlog(c *gin.Context, blogId string) (Blog, bool) {
+	blog, err := ctl.Blogs.FindById(c.Request.Context(), blogId)
+	if err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusNotFound, "blog not found")
+			return Blog{}, false
+		}
+		helpers.SendInternalServerError(c, err)
+		return Blog{}, false
+	}
+
+	caller := user.MustPrincipal(c)
+	if blog.AuthorId != caller.UserId && !caller.Can(user.PermBlogEditAny) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":     "failed",
+			"message":    "you can only modify your own posts",
+			"reason":     "not_owner",
+			"request_id": c.GetString(logger.RequestIDKey),
+		})
+		c.Abort()
+		return Blog{}, false
+	}
+
+	return blog, true
+}
+
+// TransferBlogOwnership hands a post over to another account, created_by
+// stays as it was
+func (ctl *Controller) TransferBlogOwnership(c *gin.Context) {
+	caller := user.MustPrincipal(c)
+	blogId := c.Param("id")
+
+	var body TransferRequest
+	if err := c.BindJSON(&body); err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
+		return
+	}
+
+	if _, err := ctl.Blogs.FindById(c.Request.Context(), blogId); err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusNotFound, "blog not found")
+			return
+		}
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	if _, err := ctl.Users.FindById(c.Request.Context(), body.AuthorId); err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusBadRequest, "new author not found")
+			return
+		}
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	err := ctl.Blogs.Update(c.Request.Context(), blogId, bson.M{
+		"author_id":  body.AuthorId,
+		"updated_at": time.Now(),
+		"updated_by": caller.UserId,
+	})
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "blog ownership transferred successfully",
+	})
+}
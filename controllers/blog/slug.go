@@ -0,0 +1,79 @@
+package blog
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"fadel-blog-services/configs/helpers"
+	"fadel-blog-services/configs/store"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// UniqueSlug returns base, or base with a numbered suffix when another post
+// already uses it. blogId is the post being (re)slugged, it may keep its own slug.
+func UniqueSlug(ctx context.Context, blogs BlogStore, base, blogId string) (string, error) {
+	slug := base
+	for n := 2; ; n++ {
+		found, err := blogs.FindBySlug(ctx, slug)
+		if err == store.ErrNotFound || (err == nil && found.BlogId == blogId) {
+			return slug, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+type SlugChange struct {
+	BlogId  string
+	OldSlug string
+	NewSlug string
+}
+
+// Reslug regenerates every slug from its title, e.g. after helpers.CreateSlug
+// changed. With dryRun nothing is written, the changes it reports are the
+// ones a real run makes.
+func Reslug(ctx context.Context, blogs BlogStore, dryRun bool, updatedBy string) ([]SlugChange, error) {
+	all, err := blogs.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// slugs are checked against the run so far rather than the store, a dry
+	// run doesn't write the slugs it claims or frees
+	owners := map[string]string{}
+	for _, blog := range all {
+		owners[blog.Slug] = blog.BlogId
+	}
+
+	changes := []SlugChange{}
+	for _, blog := range all {
+		base := helpers.CreateSlug(blog.Title)
+		slug := base
+		for n := 2; owners[slug] != "" && owners[slug] != blog.BlogId; n++ {
+			slug = fmt.Sprintf("%s-%d", base, n)
+		}
+		if slug == blog.Slug {
+			continue
+		}
+
+		if !dryRun {
+			err := blogs.Update(ctx, blog.BlogId, bson.M{
+				"slug":       slug,
+				"updated_at": time.Now(),
+				"updated_by": updatedBy,
+			})
+			if err != nil {
+				return changes, err
+			}
+		}
+		delete(owners, blog.Slug)
+		owners[slug] = blog.BlogId
+		changes = append(changes, SlugChange{BlogId: blog.BlogId, OldSlug: blog.Slug, NewSlug: slug})
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,50 @@
+package blog
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestReslugDryRunMatchesRun(t *testing.T) {
+	ctx := context.Background()
+	blogs := NewMemoryStore()
+	for _, b := range []Blog{
+		{BlogId: "b1", Title: "Hello World", Slug: "old-1"},
+		{BlogId: "b2", Title: "Hello World", Slug: "old-2"},
+		{BlogId: "b3", Title: "Fresh Start", Slug: "hello-world"},
+		{BlogId: "b4", Title: "Unchanged", Slug: "unchanged"},
+	} {
+		if err := blogs.Insert(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	preview, err := Reslug(ctx, blogs, true, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := blogs.FindById(ctx, "b1"); b.Slug != "old-1" {
+		t.Fatalf("dry run wrote %q", b.Slug)
+	}
+
+	applied, err := Reslug(ctx, blogs, false, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(preview, applied) {
+		t.Fatalf("dry run %v, real run %v", preview, applied)
+	}
+
+	want := map[string]string{"b1": "hello-world-2", "b2": "hello-world-3", "b3": "fresh-start", "b4": "unchanged"}
+	for blogId, slug := range want {
+		b, err := blogs.FindById(ctx, blogId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Slug != slug {
+			t.Errorf("%s has slug %q, want %q", blogId, b.Slug, slug)
+		}
+	}
+
+}
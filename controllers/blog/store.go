@@ -0,0 +1,196 @@
+package blog
+
+import (
+	"context"
+	"sync"
+
+	"fadel-blog-services/configs/store"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BlogStore covers every query the blog handlers run against storage.
+type BlogStore interface {
+	FindAll(ctx context.Context) ([]Blog, error)
+	FindBySlug(ctx context.Context, slug string) (Blog, error)
+	FindById(ctx context.Context, blogId string) (Blog, error)
+	Insert(ctx context.Context, blog Blog) error
+	Update(ctx context.Context, blogId string, set bson.M) error
+	Delete(ctx context.Context, blogId string) error
+}
+
+// MongoStore is the BlogStore backed by the "blog" collection.
+type MongoStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{coll: db.Collection("blog")}
+}
+
+func (s *MongoStore) FindAll(ctx context.Context) ([]Blog, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	blogs := []Blog{}
+	if err = cursor.All(ctx, &blogs); err != nil {
+		return nil, err
+	}
+
+	return blogs, nil
+}
+
+func (s *MongoStore) findOne(ctx context.Context, filter bson.M) (Blog, error) {
+	var blog Blog
+	err := s.coll.FindOne(ctx, filter).Decode(&blog)
+	if err == mongo.ErrNoDocuments {
+		return blog, store.ErrNotFound
+	}
+
+	return blog, err
+}
+
+func (s *MongoStore) FindBySlug(ctx context.Context, slug string) (Blog, error) {
+	return s.findOne(ctx, bson.M{"slug": slug})
+}
+
+func (s *MongoStore) FindById(ctx context.Context, blogId string) (Blog, error) {
+	return s.findOne(ctx, bson.M{"blog_id": blogId})
+}
+
+func (s *MongoStore) Insert(ctx context.Context, blog Blog) error {
+	_, err := s.coll.InsertOne(ctx, blog)
+	if mongo.IsDuplicateKeyError(err) {
+		return store.ErrDuplicate
+	}
+
+	return err
+}
+
+func (s *MongoStore) Update(ctx context.Context, blogId string, set bson.M) error {
+	res, err := s.coll.UpdateOne(ctx, bson.M{"blog_id": blogId}, bson.M{"$set": set})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return store.ErrDuplicate
+		}
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *MongoStore) Delete(ctx context.Context, blogId string) error {
+	res, err := s.coll.DeleteOne(ctx, bson.M{"blog_id": blogId})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+// MemoryStore is a thread-safe BlogStore kept in process memory, meant for
+// tests and local development.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	blogs []Blog
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) FindAll(ctx context.Context) ([]Blog, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	blogs := make([]Blog, len(s.blogs))
+	copy(blogs, s.blogs)
+	return blogs, nil
+}
+
+func (s *MemoryStore) indexOf(match func(Blog) bool) int {
+	for i, blog := range s.blogs {
+		if match(blog) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *MemoryStore) findOne(match func(Blog) bool) (Blog, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := s.indexOf(match)
+	if i < 0 {
+		return Blog{}, store.ErrNotFound
+	}
+	return s.blogs[i], nil
+}
+
+func (s *MemoryStore) FindBySlug(ctx context.Context, slug string) (Blog, error) {
+	return s.findOne(func(b Blog) bool { return b.Slug == slug })
+}
+
+func (s *MemoryStore) FindById(ctx context.Context, blogId string) (Blog, error) {
+	return s.findOne(func(b Blog) bool { return b.BlogId == blogId })
+}
+
+func (s *MemoryStore) Insert(ctx context.Context, blog Blog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the unique indexes of the mongo collection
+	if s.indexOf(func(b Blog) bool { return b.BlogId == blog.BlogId || b.Slug == blog.Slug }) >= 0 {
+		return store.ErrDuplicate
+	}
+
+	s.blogs = append(s.blogs, blog)
+	return nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, blogId string, set bson.M) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOf(func(b Blog) bool { return b.BlogId == blogId })
+	if i < 0 {
+		return store.ErrNotFound
+	}
+
+	updated := s.blogs[i]
+	if err := store.ApplySet(&updated, set); err != nil {
+		return err
+	}
+
+	if s.indexOf(func(b Blog) bool { return b.BlogId != blogId && b.Slug == updated.Slug }) >= 0 {
+		return store.ErrDuplicate
+	}
+
+	s.blogs[i] = updated
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, blogId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOf(func(b Blog) bool { return b.BlogId == blogId })
+	if i < 0 {
+		return store.ErrNotFound
+	}
+
+	s.blogs = append(s.blogs[:i], s.blogs[i+1:]...)
+	return nil
+}
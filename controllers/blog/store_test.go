@@ -0,0 +1,57 @@
+package blog
+
+import (
+	"context"
+	"testing"
+
+	"fadel-blog-services/configs/store"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMemoryStoreUniqueSlugs(t *testing.T) {
+	ctx := context.Background()
+	blogs := NewMemoryStore()
+	for _, b := range []Blog{{BlogId: "b1", Slug: "first"}, {BlogId: "b2", Slug: "second"}} {
+		if err := blogs.Insert(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inserts := []struct {
+		name string
+		blog Blog
+		want error
+	}{
+		{"new slug", Blog{BlogId: "b3", Slug: "third"}, nil},
+		{"taken slug", Blog{BlogId: "b4", Slug: "first"}, store.ErrDuplicate},
+		{"taken id", Blog{BlogId: "b1", Slug: "fourth"}, store.ErrDuplicate},
+	}
+	for _, tt := range inserts {
+		if err := blogs.Insert(ctx, tt.blog); err != tt.want {
+			t.Errorf("Insert %s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	updates := []struct {
+		name   string
+		blogId string
+		set    bson.M
+		want   error
+	}{
+		{"own slug", "b1", bson.M{"slug": "first"}, nil},
+		{"free slug", "b1", bson.M{"slug": "renamed"}, nil},
+		{"taken slug", "b2", bson.M{"slug": "renamed"}, store.ErrDuplicate},
+		{"missing blog", "b9", bson.M{"slug": "nine"}, store.ErrNotFound},
+	}
+	for _, tt := range updates {
+		if err := blogs.Update(ctx, tt.blogId, tt.set); err != tt.want {
+			t.Errorf("Update %s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// a refused update leaves the blog as it was
+	if b, err := blogs.FindById(ctx, "b2"); err != nil || b.Slug != "second" {
+		t.Fatalf("b2 = %+v, %v", b, err)
+	}
+}
@@ -10,7 +10,17 @@ type Blog struct {
 	ImageAlt  string    `form:"image_alt" bson:"image_alt" json:"image_alt"`
 	Slug      string    `bson:"slug,omitempty" json:"slug"`
 	Published string    `bson:"published,omitempty" json:"published"`
+	AuthorId  string    `bson:"author_id,omitempty" json:"author_id"`
+	CreatedBy string    `bson:"created_by,omitempty" json:"created_by"`
 	CreatedAt time.Time `bson:"created_at,omitempty" json:"created_at"`
 	UpdatedAt time.Time `bson:"updated_at,omitempty" json:"updated_at"`
 	UpdatedBy string    `bson:"updated_by,omitempty" json:"updated_by"`
 }
+
+// EditBlogRequest is all PATCH /blog/:id may change, nil fields are kept.
+// Publishing, the thumbnail and the author have endpoints of their own.
+type EditBlogRequest struct {
+	Title    *string `json:"title"`
+	Body     *string `json:"body"`
+	ImageAlt *string `json:"image_alt"`
+}
@@ -0,0 +1,97 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"fadel-blog-services/configs/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Check probes a single dependency, a nil error means it is usable
+type Check func(ctx context.Context) error
+
+type Controller struct {
+	Checks  map[string]Check
+	Timeout time.Duration
+	started time.Time
+}
+
+func NewController(checks map[string]Check) *Controller {
+	return &Controller{
+		Checks:  checks,
+		Timeout: 5 * time.Second,
+		started: time.Now(),
+	}
+}
+
+type checkResult struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Liveness only tells the process is up and serving, it never touches a
+// dependency so a flaky database doesn't get the process restarted
+func (ctl *Controller) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"uptime": time.Since(ctl.started).Round(time.Second).String(),
+		},
+	})
+}
+
+// Readiness runs every check concurrently and answers 503 when any of them
+// fails, so the replica is taken out of rotation
+func (ctl *Controller) Readiness(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), ctl.Timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := map[string]checkResult{}
+	ready := true
+
+	for name, check := range ctl.Checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := check(ctx)
+			result := checkResult{Status: "up", LatencyMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = "down"
+				result.Error = err.Error()
+				logger.From(ctx).Error("readiness check failed", "check", name,
+					"latency_ms", result.LatencyMs, "error", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = result
+			if err != nil {
+				ready = false
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":     "failed",
+			"data":       results,
+			"request_id": c.GetString(logger.RequestIDKey),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   results,
+	})
+}
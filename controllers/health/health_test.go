@@ -0,0 +1,66 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadiness(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	up := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("dial tcp 10.0.0.7:27017: connection refused") }
+
+	tests := []struct {
+		name     string
+		checks   map[string]Check
+		wantCode int
+		wantData map[string]string
+		wantErr  string
+	}{
+		{"all up", map[string]Check{"mongodb": up, "object_store": up}, http.StatusOK,
+			map[string]string{"mongodb": "up", "object_store": "up"}, ""},
+		{"one down", map[string]Check{"mongodb": up, "object_store": down}, http.StatusServiceUnavailable,
+			map[string]string{"mongodb": "up", "object_store": "down"}, "connection refused"},
+		{"no checks", map[string]Check{}, http.StatusOK, map[string]string{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/readyz", NewController(tt.checks).Readiness)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("got %d, want %d", w.Code, tt.wantCode)
+			}
+			var res struct {
+				Data map[string]checkResult `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Data) != len(tt.wantData) {
+				t.Fatalf("data %v, want %v", res.Data, tt.wantData)
+			}
+			for name, status := range tt.wantData {
+				result := res.Data[name]
+				if result.Status != status || result.LatencyMs < 0 {
+					t.Fatalf("data %v, want %v", res.Data, tt.wantData)
+				}
+				if status == "down" && !strings.Contains(result.Error, tt.wantErr) {
+					t.Fatalf("%s error %q, want %q", name, result.Error, tt.wantErr)
+				}
+				if status == "up" && result.Error != "" {
+					t.Fatalf("%s is up with error %q", name, result.Error)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package media
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"fadel-blog-services/configs/helpers"
+	"fadel-blog-services/configs/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Controller struct {
+	Objects storage.ObjectStore
+}
+
+func NewController(objects storage.ObjectStore) *Controller {
+	return &Controller{Objects: objects}
+}
+
+// GetObject streams an uploaded object, so media can be served even when
+// the object store isn't publicly reachable (e.g. the filesystem backend)
+func (ctl *Controller) GetObject(c *gin.Context) {
+	// the prefix check only holds for keys without ".." segments
+	key, err := storage.CleanKey(strings.TrimPrefix(c.Param("key"), "/"))
+	if err != nil {
+		helpers.SendFailed(c, http.StatusNotFound, "object not found")
+		return
+	}
+
+	// only uploaded media is public
+	if !strings.HasPrefix(key, "blog/") && !strings.HasPrefix(key, "profile/") {
+		helpers.SendFailed(c, http.StatusNotFound, "object not found")
+		return
+	}
+
+	object, info, err := ctl.Objects.Get(c.Request.Context(), key)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			helpers.SendFailed(c, http.StatusNotFound, "object not found")
+			return
+		}
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	defer object.Close()
+
+	// the stored type came from the uploader on older objects, the key's
+	// extension is what was validated. Anything but a plain image is only
+	// offered as a download, never rendered on the api origin.
+	headers := map[string]string{
+		"Last-Modified":           info.LastModified.UTC().Format(http.TimeFormat),
+		"Cache-Control":           "public, max-age=" + strconv.Itoa(60*60*24),
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "sandbox",
+	}
+	contentType, ok := helpers.ImageContentType(key)
+	if !ok {
+		contentType = "application/octet-stream"
+		headers["Content-Disposition"] = "attachment"
+	}
+
+	c.DataFromReader(http.StatusOK, info.Size, contentType, object, headers)
+}
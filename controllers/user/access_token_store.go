@@ -0,0 +1,195 @@
+package user
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"fadel-blog-services/configs/store"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AccessToken is a personal access token for scripts, only its hash is
+// stored. It acts for its owner within Scopes until ExpiresAt.
+type AccessToken struct {
+	TokenId    string     `bson:"token_id" json:"id"`
+	UserId     string     `bson:"user_id" json:"user_id"`
+	Name       string     `bson:"name" json:"name"`
+	Scopes     []Scope    `bson:"scopes" json:"scopes"`
+	TokenHash  string     `bson:"token_hash" json:"-"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	ExpiresAt  time.Time  `bson:"expires_at" json:"expires_at"`
+	LastUsedAt *time.Time `bson:"last_used_at,omitempty" json:"last_used_at"`
+}
+
+type AccessTokenStore interface {
+	Insert(ctx context.Context, token AccessToken) error
+	FindByHash(ctx context.Context, tokenHash string) (AccessToken, error)
+	// FindByUser lists the tokens of a user, newest first
+	FindByUser(ctx context.Context, userId string) ([]AccessToken, error)
+	Touch(ctx context.Context, tokenId string, usedAt time.Time) error
+	// Delete only removes the token when it belongs to userId
+	Delete(ctx context.Context, userId, tokenId string) error
+	// DeleteUser removes every token of the user
+	DeleteUser(ctx context.Context, userId string) error
+}
+
+// MongoAccessTokenStore is the AccessTokenStore backed by the
+// "access_token" collection, expired documents are purged by a ttl index
+type MongoAccessTokenStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoAccessTokenStore(db *mongo.Database) *MongoAccessTokenStore {
+	return &MongoAccessTokenStore{coll: db.Collection("access_token")}
+}
+
+func (s *MongoAccessTokenStore) Insert(ctx context.Context, token AccessToken) error {
+	_, err := s.coll.InsertOne(ctx, token)
+	if mongo.IsDuplicateKeyError(err) {
+		return store.ErrDuplicate
+	}
+
+	return err
+}
+
+func (s *MongoAccessTokenStore) FindByHash(ctx context.Context, tokenHash string) (AccessToken, error) {
+	var token AccessToken
+	err := s.coll.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return token, store.ErrNotFound
+	}
+
+	return token, err
+}
+
+func (s *MongoAccessTokenStore) FindByUser(ctx context.Context, userId string) ([]AccessToken, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{"user_id": userId}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := []AccessToken{}
+	if err = cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (s *MongoAccessTokenStore) Touch(ctx context.Context, tokenId string, usedAt time.Time) error {
+	_, err := s.coll.UpdateOne(ctx, bson.M{"token_id": tokenId}, bson.M{"$set": bson.M{"last_used_at": usedAt}})
+	return err
+}
+
+func (s *MongoAccessTokenStore) Delete(ctx context.Context, userId, tokenId string) error {
+	res, err := s.coll.DeleteOne(ctx, bson.M{"token_id": tokenId, "user_id": userId})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *MongoAccessTokenStore) DeleteUser(ctx context.Context, userId string) error {
+	_, err := s.coll.DeleteMany(ctx, bson.M{"user_id": userId})
+	return err
+}
+
+// MemoryAccessTokenStore is a thread-safe AccessTokenStore kept in process
+// memory, meant for tests and local development
+type MemoryAccessTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]AccessToken
+}
+
+func NewMemoryAccessTokenStore() *MemoryAccessTokenStore {
+	return &MemoryAccessTokenStore{tokens: map[string]AccessToken{}}
+}
+
+func (s *MemoryAccessTokenStore) Insert(ctx context.Context, token AccessToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.tokens {
+		if existing.TokenHash == token.TokenHash {
+			return store.ErrDuplicate
+		}
+	}
+	if _, ok := s.tokens[token.TokenId]; ok {
+		return store.ErrDuplicate
+	}
+	s.tokens[token.TokenId] = token
+	return nil
+}
+
+func (s *MemoryAccessTokenStore) FindByHash(ctx context.Context, tokenHash string) (AccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, token := range s.tokens {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
+	}
+	return AccessToken{}, store.ErrNotFound
+}
+
+func (s *MemoryAccessTokenStore) FindByUser(ctx context.Context, userId string) ([]AccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := []AccessToken{}
+	for _, token := range s.tokens {
+		if token.UserId == userId {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.After(tokens[j].CreatedAt) })
+	return tokens, nil
+}
+
+func (s *MemoryAccessTokenStore) Touch(ctx context.Context, tokenId string, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[tokenId]
+	if !ok {
+		return nil
+	}
+	token.LastUsedAt = &usedAt
+	s.tokens[tokenId] = token
+	return nil
+}
+
+func (s *MemoryAccessTokenStore) Delete(ctx context.Context, userId, tokenId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[tokenId]
+	if !ok || token.UserId != userId {
+		return store.ErrNotFound
+	}
+	delete(s.tokens, tokenId)
+	return nil
+}
+
+func (s *MemoryAccessTokenStore) DeleteUser(ctx context.Context, userId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenId, token := range s.tokens {
+		if token.UserId == userId {
+			delete(s.tokens, tokenId)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"fadel-blog-services/configs/helpers"
+	"fadel-blog-services/configs/logger"
+	"fadel-blog-services/configs/store"
+	"fadel-blog-services/configs/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessTokenPrefix tells personal access tokens apart from jwts in the
+// Authorization header, and makes leaked ones easy to grep for
+const AccessTokenPrefix = "fbs_pat_"
+
+// last_used_at is written at most this often, not on every request
+const touchInterval = time.Minute
+
+type CreateAccessTokenRequest struct {
+	Name          string  `json:"name" binding:"required"`
+	Scopes        []Scope `json:"scopes" binding:"required"`
+	ExpiresInDays int     `json:"expires_in_days" binding:"required"`
+}
+
+// authAccessToken is the Auth path of personal access tokens. The owner is
+// looked up on every request, so disabling the account or changing its
+// role applies right away.
+func (ctl *Controller) authAccessToken(c *gin.Context, plain string) {
+	ctx := c.Request.Context()
+
+	accessToken, err := ctl.AccessTokens.FindByHash(ctx, token.HashOpaque(plain))
+	if err != nil && err != store.ErrNotFound {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if err == store.ErrNotFound || time.Now().After(accessToken.ExpiresAt) {
+		sendUnauthorized(c, "access token is invalid or expired")
+		return
+	}
+
+	owner, err := ctl.Users.FindById(ctx, accessToken.UserId)
+	if err != nil && err != store.ErrNotFound {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if err == store.ErrNotFound || owner.Disabled {
+		sendUnauthorized(c, "access token owner is disabled or gone")
+		return
+	}
+
+	if accessToken.LastUsedAt == nil || time.Since(*accessToken.LastUsedAt) > touchInterval {
+		if err := ctl.AccessTokens.Touch(ctx, accessToken.TokenId, time.Now()); err != nil {
+			logger.From(ctx).Warn("updating access token last use", "token_id", accessToken.TokenId, "error", err)
+		}
+		if err := ctl.seenAccessToken(c, accessToken); err != nil {
+			logger.From(ctx).Warn("recording access token session", "token_id", accessToken.TokenId, "error", err)
+		}
+	}
+
+	setPrincipal(c, &Principal{
+		UserId:        owner.UserId,
+		Username:      owner.Username,
+		Role:          owner.Role,
+		AccessTokenId: accessToken.TokenId,
+		Scopes:        accessToken.Scopes,
+	})
+	c.Next()
+}
+
+func sendUnauthorized(c *gin.Context, reason string) {
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"message":    "Not authorized",
+		"error":      reason,
+		"request_id": c.GetString(logger.RequestIDKey),
+	})
+	c.Abort()
+}
+
+// GetAccessTokens lists the caller's personal access tokens, never the
+// tokens themselves
+func (ctl *Controller) GetAccessTokens(c *gin.Context) {
+	tokens, err := ctl.AccessTokens.FindByUser(c.Request.Context(), MustPrincipal(c).UserId)
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   tokens,
+	})
+}
+
+// CreateAccessToken mints a personal access token. The token is only part
+// of this response, afterwards nothing but its hash is left.
+func (ctl *Controller) CreateAccessToken(c *gin.Context) {
+	caller := MustPrincipal(c)
+
+	var body CreateAccessTokenRequest
+	if err := c.BindJSON(&body); err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
+		return
+	}
+
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" || len(body.Name) > 100 {
+		helpers.SendFailed(c, http.StatusBadRequest, "name must be 1 to 100 characters")
+		return
+	}
+	if len(body.Scopes) == 0 {
+		helpers.SendFailed(c, http.StatusBadRequest, "at least one scope is required")
+		return
+	}
+	for _, scope := range body.Scopes {
+		if !scope.Valid() {
+			helpers.SendFailed(c, http.StatusBadRequest, fmt.Sprintf("unknown scope %q, must be blog:write, media:write or users:read", scope))
+			return
+		}
+	}
+	maxDays := int(ctl.AccessTokenMaxTTL / (24 * time.Hour))
+	if body.ExpiresInDays < 1 || body.ExpiresInDays > maxDays {
+		helpers.SendFailed(c, http.StatusBadRequest, fmt.Sprintf("expires_in_days must be between 1 and %d", maxDays))
+		return
+	}
+
+	tokenId, err := helpers.CreateUUIDStr()
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	random, _, err := token.NewOpaque()
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	plain := AccessTokenPrefix + random
+
+	now := time.Now()
+	accessToken := AccessToken{
+		TokenId:   tokenId,
+		UserId:    caller.UserId,
+		Name:      body.Name,
+		Scopes:    body.Scopes,
+		TokenHash: token.HashOpaque(plain),
+		CreatedAt: now,
+		ExpiresAt: now.AddDate(0, 0, body.ExpiresInDays),
+	}
+
+	if err := ctl.AccessTokens.Insert(c.Request.Context(), accessToken); err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "access token created, copy it now, it won't be shown again",
+		"data": gin.H{
+			"token":        plain,
+			"access_token": accessToken,
+		},
+	})
+}
+
+// DeleteAccessToken revokes one of the caller's personal access tokens
+func (ctl *Controller) DeleteAccessToken(c *gin.Context) {
+	err := ctl.AccessTokens.Delete(c.Request.Context(), MustPrincipal(c).UserId, c.Param("id"))
+	if err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusNotFound, "access token not found")
+			return
+		}
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	if _, err := ctl.Sessions.End(c.Request.Context(), c.Param("id"), time.Now()); err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "access token revoked",
+	})
+}
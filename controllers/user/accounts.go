@@ -0,0 +1,166 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+
+	"fadel-blog-services/configs/helpers"
+	"fadel-blog-services/configs/store"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Account operations shared by the http handlers and the admin cli
+
+var (
+	ErrUsernameTaken = errors.New("username already taken")
+	ErrEmailTaken    = errors.New("email already in use")
+	ErrInvalidEmail  = errors.New("invalid email address")
+	ErrInvalidRole   = errors.New("invalid role, must be admin, editor, author or contributor")
+)
+
+// NormalizeEmail validates a bare address like someone@example.com and
+// lowercases it, so lookups don't depend on how it was typed
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(email), nil
+}
+
+// CreateUser stores a new account, the password has to pass the policy
+func CreateUser(ctx context.Context, users UserStore, passwords *PasswordPolicy, data User, createdBy string) (User, error) {
+	role := data.Role
+	if role == "" {
+		role = DefaultRole
+	}
+	if !role.Valid() {
+		return User{}, ErrInvalidRole
+	}
+
+	if err := passwords.Check(data.Password); err != nil {
+		return User{}, err
+	}
+
+	// check if there's user with the same username
+	_, err := users.FindByUsername(ctx, data.Username)
+	if err == nil {
+		return User{}, ErrUsernameTaken
+	}
+	if err != store.ErrNotFound {
+		return User{}, err
+	}
+
+	// email is optional, without it the password can't be reset by mail
+	email := ""
+	if data.Email != "" {
+		if email, err = NormalizeEmail(data.Email); err != nil {
+			return User{}, err
+		}
+		_, err = users.FindByEmail(ctx, email)
+		if err == nil {
+			return User{}, ErrEmailTaken
+		}
+		if err != store.ErrNotFound {
+			return User{}, err
+		}
+	}
+
+	// create and uuid string to be stored at db
+	newUserId, err := helpers.CreateUUIDStr()
+	if err != nil {
+		return User{}, err
+	}
+
+	hash, err := passwords.Hash(data.Password)
+	if err != nil {
+		return User{}, err
+	}
+
+	newUser := User{
+		UserId:            newUserId,
+		Fullname:          data.Fullname,
+		Username:          data.Username,
+		Email:             email,
+		Password:          hash,
+		ProfilePictureURL: "", // default is empty
+		PhoneNumber:       data.PhoneNumber,
+		Role:              role,
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+		UpdatedBy:         createdBy,
+	}
+
+	if err := users.Insert(ctx, newUser); err != nil {
+		// unique index on username or email, someone took it in the meantime
+		if err == store.ErrDuplicate {
+			if _, err := users.FindByEmail(ctx, email); err == nil {
+				return User{}, ErrEmailTaken
+			}
+			return User{}, ErrUsernameTaken
+		}
+		return User{}, err
+	}
+
+	return newUser, nil
+}
+
+func SetPassword(ctx context.Context, users UserStore, passwords *PasswordPolicy, userId, password, updatedBy string) error {
+	hash, err := passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	return users.Update(ctx, userId, bson.M{
+		"password":   hash,
+		"updated_at": time.Now(),
+		"updated_by": updatedBy,
+	})
+}
+
+// SetDisabled (un)blocks an account, disabled accounts can't log in
+func SetDisabled(ctx context.Context, users UserStore, userId string, disabled bool, updatedBy string) error {
+	return users.Update(ctx, userId, bson.M{
+		"disabled":   disabled,
+		"updated_at": time.Now(),
+		"updated_by": updatedBy,
+	})
+}
+
+// SetRole changes the role of an account, callers revoke its sessions so
+// tokens carrying the old role stop working
+func SetRole(ctx context.Context, users UserStore, userId string, role Role, updatedBy string) error {
+	if !role.Valid() {
+		return ErrInvalidRole
+	}
+
+	return users.Update(ctx, userId, bson.M{
+		"role":       role,
+		"updated_at": time.Now(),
+		"updated_by": updatedBy,
+	})
+}
+
+// RevokeSessions kills every access and refresh token of the user, deletes
+// their personal access tokens and ends their sessions, accessTTL is how
+// long already issued access tokens stay valid
+func RevokeSessions(ctx context.Context, revocations *RevocationList, refreshTokens RefreshTokenStore, accessTokens AccessTokenStore, sessions SessionStore, userId string, accessTTL time.Duration) error {
+	if err := revocations.RevokeUser(ctx, userId, accessTTL); err != nil {
+		return err
+	}
+
+	if err := refreshTokens.RevokeUser(ctx, userId); err != nil {
+		return err
+	}
+
+	if err := accessTokens.DeleteUser(ctx, userId); err != nil {
+		return err
+	}
+
+	return sessions.EndUser(ctx, userId, time.Now())
+}
@@ -0,0 +1,38 @@
+package user
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSetRole(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryStore()
+	if err := users.Insert(ctx, User{UserId: "u1", Username: "alice", Role: RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		role     Role
+		wantErr  bool
+		wantRole Role
+	}{
+		{RoleEditor, false, RoleEditor},
+		{"owner", true, RoleEditor},
+		{"", true, RoleEditor},
+		{RoleContributor, false, RoleContributor},
+	}
+	for _, tt := range tests {
+		err := SetRole(ctx, users, "u1", tt.role, "cli")
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("SetRole(%q) = %v, wantErr %v", tt.role, err, tt.wantErr)
+		}
+		user, err := users.FindById(ctx, "u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Role != tt.wantRole {
+			t.Fatalf("after SetRole(%q) role is %q, want %q", tt.role, user.Role, tt.wantRole)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package user
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"fadel-blog-services/configs/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// SessionModeHeader set to "cookie" on a login asks for cookies instead
+	// of tokens in the body
+	SessionModeHeader = "X-Session-Mode"
+	// CSRFHeader has to repeat the csrf cookie on unsafe requests
+	// authenticated by cookie
+	CSRFHeader = "X-CSRF-Token"
+
+	SessionCookie = "fbs_session"
+	RefreshCookie = "fbs_refresh"
+	CSRFCookie    = "fbs_csrf"
+
+	// the refresh cookie is only sent where it is needed
+	refreshCookiePath = "/token/refresh"
+)
+
+// CookieOptions configure the cookie session mode, it is off unless Enabled
+type CookieOptions struct {
+	Enabled  bool
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// wantsCookies reports whether a login asked for the cookie session mode
+func (ctl *Controller) wantsCookies(c *gin.Context) bool {
+	return ctl.Cookies.Enabled && c.GetHeader(SessionModeHeader) == "cookie"
+}
+
+func (ctl *Controller) setCookie(c *gin.Context, name, value, path string, httpOnly bool, expiresAt time.Time) {
+	maxAge := int(time.Until(expiresAt).Seconds())
+	if maxAge <= 0 {
+		maxAge = -1
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   ctl.Cookies.Domain,
+		Expires:  expiresAt,
+		MaxAge:   maxAge,
+		Secure:   ctl.Cookies.Secure,
+		HttpOnly: httpOnly,
+		SameSite: ctl.Cookies.SameSite,
+	})
+}
+
+// sendCookies moves the tokens of data from issueTokens into HttpOnly
+// cookies. The csrf token takes their place, a frontend on another origin
+// can't read it from its cookie.
+func (ctl *Controller) sendCookies(c *gin.Context, data gin.H) error {
+	csrf, _, err := token.NewOpaque()
+	if err != nil {
+		return err
+	}
+
+	refreshExpiresAt := time.Now().Add(ctl.RefreshTTL)
+	ctl.setCookie(c, SessionCookie, data["token"].(string), "/", true, data["expires_at"].(time.Time))
+	ctl.setCookie(c, RefreshCookie, data["refresh_token"].(string), refreshCookiePath, true, refreshExpiresAt)
+	ctl.setCookie(c, CSRFCookie, csrf, "/", false, refreshExpiresAt)
+
+	delete(data, "token")
+	delete(data, "refresh_token")
+	data["csrf_token"] = csrf
+	return nil
+}
+
+// clearCookies drops every session cookie
+func (ctl *Controller) clearCookies(c *gin.Context) {
+	ctl.setCookie(c, SessionCookie, "", "/", true, time.Time{})
+	ctl.setCookie(c, RefreshCookie, "", refreshCookiePath, true, time.Time{})
+	ctl.setCookie(c, CSRFCookie, "", "/", false, time.Time{})
+}
+
+// checkCSRF is the double submit check of cookie authenticated requests:
+// unsafe methods must echo the csrf cookie in CSRFHeader, which a page on
+// another origin can't read
+func checkCSRF(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	cookie, err := c.Cookie(CSRFCookie)
+	if err != nil || cookie == "" {
+		return false
+	}
+	header := c.GetHeader(CSRFHeader)
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
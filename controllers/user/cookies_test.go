@@ -0,0 +1,46 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckCSRF(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		method string
+		cookie string
+		header string
+		want   bool
+	}{
+		{"get needs no token", http.MethodGet, "", "", true},
+		{"head needs no token", http.MethodHead, "", "", true},
+		{"options needs no token", http.MethodOptions, "", "", true},
+		{"matching token", http.MethodPost, "abc", "abc", true},
+		{"missing header", http.MethodPost, "abc", "", false},
+		{"missing cookie", http.MethodDelete, "", "abc", false},
+		{"both empty", http.MethodPatch, "", "", false},
+		{"mismatch", http.MethodPut, "abc", "abd", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(tt.method, "/", nil)
+			if tt.cookie != "" {
+				c.Request.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				c.Request.Header.Set(CSRFHeader, tt.header)
+			}
+
+			if got := checkCSRF(c); got != tt.want {
+				t.Fatalf("checkCSRF = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"fadel-blog-services/configs/helpers"
+	"fadel-blog-services/configs/logger"
+	"fadel-blog-services/configs/oidc"
+	"fadel-blog-services/configs/store"
+	"fadel-blog-services/configs/token"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// OIDCLoginStart starts a login at the identity provider. The client sends
+// the browser to authorization_url, keeps state, and posts the code and
+// state it gets back on OIDC_REDIRECT_URL to /oidc/callback.
+func (ctl *Controller) OIDCLoginStart(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	state, err := oidc.NewNonce()
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	nonce, err := oidc.NewNonce()
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	authURL, err := ctl.OIDC.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		logger.From(ctx).Error("starting oidc login", "error", err)
+		helpers.SendFailed(c, http.StatusBadGateway, "identity provider is unavailable")
+		return
+	}
+
+	now := time.Now()
+	err = ctl.OIDCLogins.Insert(ctx, OIDCLogin{
+		StateHash:    token.HashOpaque(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(ctl.OIDCLoginTTL),
+	})
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"authorization_url": authURL,
+			"state":             state,
+			"expires_at":        now.Add(ctl.OIDCLoginTTL),
+		},
+	})
+}
+
+// OIDCCallback finishes a login started by OIDCLoginStart. The linked
+// account gets the same tokens as a password login, after its second factor
+// when it needs one.
+func (ctl *Controller) OIDCCallback(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var body OIDCCallbackRequest
+	if err := c.BindJSON(&body); err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
+		return
+	}
+
+	login, err := ctl.OIDCLogins.Take(ctx, token.HashOpaque(body.State))
+	if err != nil && err != store.ErrNotFound {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if err == store.ErrNotFound || time.Now().After(login.ExpiresAt) {
+		helpers.SendFailed(c, http.StatusUnauthorized, "unknown or expired login, please start again")
+		return
+	}
+
+	idToken, err := ctl.OIDC.Exchange(ctx, body.Code, login.CodeVerifier)
+	if err != nil {
+		logger.From(ctx).Warn("oidc code exchange failed", "error", err)
+		helpers.SendFailed(c, http.StatusUnauthorized, "identity provider refused the login")
+		return
+	}
+
+	claims, err := ctl.OIDC.VerifyIDToken(ctx, idToken, login.Nonce)
+	if err != nil {
+		logger.From(ctx).Warn("oidc id token rejected", "error", err)
+		helpers.SendFailed(c, http.StatusUnauthorized, "identity provider refused the login")
+		return
+	}
+
+	user, ok := ctl.oidcUser(c, claims)
+	if !ok {
+		return
+	}
+	if user.Disabled {
+		helpers.SendFailed(c, http.StatusForbidden, "account is disabled")
+		return
+	}
+
+	needsCode, err := ctl.requiresTwoFactor(c, user)
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if needsCode {
+		ctl.sendChallenge(c, user, MethodOIDC)
+		return
+	}
+
+	ctl.completeLogin(c, user, MethodOIDC, nil)
+}
+
+// oidcUser finds the account linked to the provider subject. Failing that
+// it links the account with the same verified email, or provisions one.
+func (ctl *Controller) oidcUser(c *gin.Context, claims oidc.Claims) (User, bool) {
+	ctx := c.Request.Context()
+	l := logger.From(ctx)
+
+	user, err := ctl.Users.FindByOIDC(ctx, claims.Issuer, claims.Subject)
+	if err == nil {
+		return user, true
+	}
+	if err != store.ErrNotFound {
+		helpers.SendInternalServerError(c, err)
+		return User{}, false
+	}
+
+	email := ""
+	if claims.EmailVerified {
+		email, _ = NormalizeEmail(claims.Email)
+	}
+
+	if ctl.OIDCLinkByEmail && email != "" {
+		user, err := ctl.Users.FindByEmail(ctx, email)
+		if err == nil {
+			// whoever controls the address at the provider would get the
+			// account, privileged ones are never handed out that way
+			if user.Role == RoleAdmin || user.Role == RoleEditor {
+				l.Warn("refused linking oidc identity by email", "user_id", user.UserId, "role", user.Role, "oidc_subject", claims.Subject)
+				helpers.SendFailed(c, http.StatusForbidden, fmt.Sprintf("%s accounts aren't linked by email", user.Role))
+				return User{}, false
+			}
+			if user.OIDCSubject != "" {
+				helpers.SendFailed(c, http.StatusConflict, "account is already linked to another identity")
+				return User{}, false
+			}
+
+			err = ctl.Users.Update(ctx, user.UserId, bson.M{
+				"oidc_issuer":  claims.Issuer,
+				"oidc_subject": claims.Subject,
+				"updated_at":   time.Now(),
+			})
+			if err != nil {
+				helpers.SendInternalServerError(c, err)
+				return User{}, false
+			}
+			l.Info("linked oidc identity", "user_id", user.UserId, "oidc_subject", claims.Subject)
+			return user, true
+		}
+		if err != store.ErrNotFound {
+			helpers.SendInternalServerError(c, err)
+			return User{}, false
+		}
+	}
+
+	if !ctl.OIDCAutoProvision {
+		helpers.SendFailed(c, http.StatusForbidden, "no account is linked to this identity")
+		return User{}, false
+	}
+
+	user, err = provisionOIDCUser(ctx, ctl.Users, claims, email, ctl.OIDCDefaultRole)
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return User{}, false
+	}
+	l.Info("provisioned oidc user", "user_id", user.UserId, "username", user.Username, "oidc_subject", claims.Subject)
+	return user, true
+}
+
+// provisionOIDCUser creates an account without a password, it can only log
+// in through the identity provider until a password is set by reset
+func provisionOIDCUser(ctx context.Context, users UserStore, claims oidc.Claims, email string, role Role) (User, error) {
+	if email != "" {
+		if _, err := users.FindByEmail(ctx, email); err == nil {
+			// taken by an account we may not link to, the address stays off
+			email = ""
+		} else if err != store.ErrNotFound {
+			return User{}, err
+		}
+	}
+
+	userId, err := helpers.CreateUUIDStr()
+	if err != nil {
+		return User{}, err
+	}
+
+	base := oidcUsername(claims)
+	now := time.Now()
+	newUser := User{
+		UserId:      userId,
+		Fullname:    claims.Name,
+		Username:    base,
+		Email:       email,
+		Role:        role,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		UpdatedBy:   "oidc",
+		OIDCIssuer:  claims.Issuer,
+		OIDCSubject: claims.Subject,
+	}
+
+	// a taken username gets a random suffix, a few tries are plenty
+	for i := 0; i < 5; i++ {
+		err = users.Insert(ctx, newUser)
+		if err != store.ErrDuplicate {
+			break
+		}
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return User{}, err
+		}
+		newUser.Username = base + "-" + hex.EncodeToString(suffix)
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	return newUser, nil
+}
+
+// oidcUsername derives a username from preferred_username or the email
+func oidcUsername(claims oidc.Claims) string {
+	name := claims.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '_' || r == '-' {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "user"
+	}
+	if b.Len() > 40 {
+		return b.String()[:40]
+	}
+	return b.String()
+}
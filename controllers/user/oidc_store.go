@@ -0,0 +1,84 @@
+package user
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"fadel-blog-services/configs/store"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// OIDCLogin is a started identity provider login, waiting for the browser
+// to come back with a code. Only the hash of the state is stored.
+type OIDCLogin struct {
+	StateHash    string    `bson:"state_hash"`
+	Nonce        string    `bson:"nonce"`
+	CodeVerifier string    `bson:"code_verifier"`
+	CreatedAt    time.Time `bson:"created_at"`
+	ExpiresAt    time.Time `bson:"expires_at"`
+}
+
+type OIDCLoginStore interface {
+	Insert(ctx context.Context, login OIDCLogin) error
+	// Take returns the login and removes it, so every state is used once
+	Take(ctx context.Context, stateHash string) (OIDCLogin, error)
+}
+
+// MongoOIDCLoginStore is the OIDCLoginStore backed by the "oidc_login"
+// collection, abandoned logins are purged by a ttl index
+type MongoOIDCLoginStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoOIDCLoginStore(db *mongo.Database) *MongoOIDCLoginStore {
+	return &MongoOIDCLoginStore{coll: db.Collection("oidc_login")}
+}
+
+func (s *MongoOIDCLoginStore) Insert(ctx context.Context, login OIDCLogin) error {
+	_, err := s.coll.InsertOne(ctx, login)
+	return err
+}
+
+func (s *MongoOIDCLoginStore) Take(ctx context.Context, stateHash string) (OIDCLogin, error) {
+	var login OIDCLogin
+	err := s.coll.FindOneAndDelete(ctx, bson.M{"state_hash": stateHash}).Decode(&login)
+	if err == mongo.ErrNoDocuments {
+		return login, store.ErrNotFound
+	}
+
+	return login, err
+}
+
+// MemoryOIDCLoginStore is a thread-safe OIDCLoginStore kept in process
+// memory, meant for tests and local development
+type MemoryOIDCLoginStore struct {
+	mu     sync.Mutex
+	logins map[string]OIDCLogin
+}
+
+func NewMemoryOIDCLoginStore() *MemoryOIDCLoginStore {
+	return &MemoryOIDCLoginStore{logins: map[string]OIDCLogin{}}
+}
+
+func (s *MemoryOIDCLoginStore) Insert(ctx context.Context, login OIDCLogin) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logins[login.StateHash] = login
+	return nil
+}
+
+func (s *MemoryOIDCLoginStore) Take(ctx context.Context, stateHash string) (OIDCLogin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	login, ok := s.logins[stateHash]
+	if !ok {
+		return OIDCLogin{}, store.ErrNotFound
+	}
+	delete(s.logins, stateHash)
+	return login, nil
+}
@@ -0,0 +1,211 @@
+package user
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"fadel-blog-services/configs/helpers"
+	"fadel-blog-services/configs/logger"
+	"fadel-blog-services/configs/store"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt only looks at the first 72 bytes, anything after would be ignored silently
+const maxPasswordBytes = 72
+
+var ErrWrongPassword = errors.New("current password is wrong")
+
+// WeakPasswordError is returned when a new password doesn't meet the policy
+type WeakPasswordError struct {
+	Reason string
+}
+
+func (e *WeakPasswordError) Error() string {
+	return "password " + e.Reason
+}
+
+// PasswordPolicy decides which passwords are accepted and how they are hashed
+type PasswordPolicy struct {
+	MinLength int
+	Cost      int
+	// breached holds the lowercased entries of the breach wordlist
+	breached map[string]struct{}
+}
+
+// NewPasswordPolicy loads the breach wordlist at breachList, one password
+// per line, lines starting with # are skipped. An empty path disables it.
+func NewPasswordPolicy(minLength, cost int, breachList string) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{MinLength: minLength, Cost: cost, breached: map[string]struct{}{}}
+	if breachList == "" {
+		return policy, nil
+	}
+
+	file, err := os.Open(breachList)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		policy.breached[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", breachList, err)
+	}
+
+	return policy, nil
+}
+
+// Check returns a *WeakPasswordError when password can't be used
+func (p *PasswordPolicy) Check(password string) error {
+	if len([]rune(password)) < p.MinLength {
+		return &WeakPasswordError{Reason: fmt.Sprintf("must be at least %d characters", p.MinLength)}
+	}
+	if len(password) > maxPasswordBytes {
+		return &WeakPasswordError{Reason: fmt.Sprintf("must be at most %d bytes", maxPasswordBytes)}
+	}
+	if _, ok := p.breached[strings.ToLower(password)]; ok {
+		return &WeakPasswordError{Reason: "appears in a list of breached passwords, choose another one"}
+	}
+	return nil
+}
+
+// Hash checks password against the policy and hashes it with the configured cost
+func (p *PasswordPolicy) Hash(password string) (string, error) {
+	if err := p.Check(password); err != nil {
+		return "", err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), p.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// NeedsRehash reports whether hash was made with a lower cost than configured
+func (p *PasswordPolicy) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < p.Cost
+}
+
+// rehash upgrades the stored hash of a user who just proved the password,
+// a failure only costs the upgrade, not the login
+func (ctl *Controller) rehash(c *gin.Context, user User, password string) {
+	if !ctl.Passwords.NeedsRehash(user.Password) {
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), ctl.Passwords.Cost)
+	if err == nil {
+		// updated_at/updated_by are left alone, nothing the user did changed
+		err = ctl.Users.Update(c.Request.Context(), user.UserId, bson.M{"password": string(hash)})
+	}
+	if err != nil {
+		logger.From(c.Request.Context()).Warn("rehashing password failed", "user_id", user.UserId, "error", err)
+	}
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword sets a new password for the caller, who has to prove the
+// current one. Every session is revoked afterwards, so the client logs in again.
+func (ctl *Controller) ChangePassword(c *gin.Context) {
+	userId := MustPrincipal(c).UserId
+	ctx := c.Request.Context()
+
+	var body ChangePasswordRequest
+	if err := c.BindJSON(&body); err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
+		return
+	}
+
+	user, err := ctl.Users.FindById(ctx, userId)
+	if err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusUnauthorized, "user not found")
+			return
+		}
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	// a stolen access token must not buy unlimited guesses at the password
+	attempt, wait, err := ctl.PasswordThrottle.Reserve(ctx, userId, c.ClientIP())
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if wait > 0 {
+		ctl.passwordCheckFailed(c, userId, ReasonThrottled)
+		sendThrottled(c, "wrong passwords", wait)
+		return
+	}
+
+	if !CheckPasswordHash(body.CurrentPassword, user.Password) {
+		ctl.passwordCheckFailed(c, userId, ReasonWrongCurrentPassword)
+		helpers.SendFailed(c, http.StatusBadRequest, ErrWrongPassword.Error())
+		return
+	}
+
+	if err := ctl.PasswordThrottle.Success(ctx, attempt); err != nil {
+		logger.From(ctx).Error("clearing password check failures", "error", err)
+	}
+	if body.NewPassword == body.CurrentPassword {
+		helpers.SendFailed(c, http.StatusBadRequest, "new password must differ from the current one")
+		return
+	}
+
+	if err := SetPassword(ctx, ctl.Users, ctl.Passwords, userId, body.NewPassword, userId); err != nil {
+		var weak *WeakPasswordError
+		if errors.As(err, &weak) {
+			helpers.SendFailed(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	if err := RevokeSessions(ctx, ctl.Revocations, ctl.RefreshTokens, ctl.AccessTokens, ctl.Sessions, userId, ctl.Tokens.TTL); err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "password changed, please log in again",
+	})
+}
+
+// passwordCheckFailed records a wrong current password next to the failed
+// logins, a failure to record it is only logged
+func (ctl *Controller) passwordCheckFailed(c *gin.Context, userId, reason string) {
+	l := logger.From(c.Request.Context())
+	l.Warn("password check failed", "user_id", userId, "client_ip", c.ClientIP(), "reason", reason)
+
+	err := ctl.PasswordThrottle.Failure(c.Request.Context(), LoginFailure{
+		Username:  userId,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Reason:    reason,
+		RequestId: c.GetString(logger.RequestIDKey),
+	})
+	if err != nil {
+		l.Error("recording password check failure", "error", err)
+	}
+}
@@ -0,0 +1,76 @@
+package user
+
+import (
+	"time"
+
+	"fadel-blog-services/configs/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+const principalKey = "principal"
+
+// Principal is the caller of a request that passed Auth
+type Principal struct {
+	UserId   string
+	Username string
+	Role     Role
+
+	// SessionId is the login a jwt belongs to, see sessions.go
+	SessionId string
+
+	// TokenId and ExpiresAt are the jti and exp of a jwt, Logout revokes
+	// the token by them
+	TokenId   string
+	ExpiresAt time.Time
+
+	// AccessTokenId and Scopes are set for personal access tokens only, nil
+	// Scopes leave the role unrestricted
+	AccessTokenId string
+	Scopes        []Scope
+}
+
+// Can reports whether the role, and the scopes if any, grant perm
+func (p *Principal) Can(perm Permission) bool {
+	if !p.Role.Can(perm) {
+		return false
+	}
+	if p.Scopes == nil {
+		return true
+	}
+
+	for _, scope := range p.Scopes {
+		for _, granted := range scopePermissions[scope] {
+			if granted == perm {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setPrincipal authenticates the request as p, later log lines of the
+// request carry the user id
+func setPrincipal(c *gin.Context, p *Principal) {
+	c.Set(principalKey, p)
+	c.Set(logger.UserIDKey, p.UserId)
+
+	l := logger.From(c.Request.Context()).With("user_id", p.UserId)
+	c.Request = c.Request.WithContext(logger.NewContext(c.Request.Context(), l))
+}
+
+// GetPrincipal returns the caller, nil when the request didn't pass Auth
+func GetPrincipal(c *gin.Context) *Principal {
+	p, _ := c.Get(principalKey)
+	principal, _ := p.(*Principal)
+	return principal
+}
+
+// MustPrincipal returns the caller of a handler that only runs after Auth
+func MustPrincipal(c *gin.Context) *Principal {
+	principal := GetPrincipal(c)
+	if principal == nil {
+		panic("user: no principal, the route is missing Auth")
+	}
+	return principal
+}
@@ -0,0 +1,140 @@
+package user
+
+import (
+	"net/http"
+
+	"fadel-blog-services/configs/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Role string
+
+const (
+	RoleAdmin       Role = "admin"
+	RoleEditor      Role = "editor"
+	RoleAuthor      Role = "author"
+	RoleContributor Role = "contributor"
+)
+
+// DefaultRole is given to accounts created without an explicit role
+const DefaultRole = RoleContributor
+
+type Permission string
+
+const (
+	PermUsersRead    Permission = "users:read"
+	PermUsersManage  Permission = "users:manage"
+	PermProfileWrite Permission = "profile:write"
+	PermBlogCreate   Permission = "blog:create"
+	PermBlogEdit     Permission = "blog:edit"
+	PermBlogDelete   Permission = "blog:delete"
+	PermBlogPublish  Permission = "blog:publish"
+	// PermBlogEditAny lifts the ownership check, without it only own posts can be modified
+	PermBlogEditAny    Permission = "blog:edit_any"
+	PermBlogTransfer   Permission = "blog:transfer"
+	PermSessionsManage Permission = "sessions:manage"
+	// PermAccount covers the caller's own credentials: password, 2fa,
+	// access tokens and logout. No access token scope grants it.
+	PermAccount Permission = "account:manage"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {
+		PermAccount, PermUsersRead, PermUsersManage, PermProfileWrite, PermSessionsManage,
+		PermBlogCreate, PermBlogEdit, PermBlogDelete, PermBlogPublish, PermBlogEditAny, PermBlogTransfer,
+	},
+	RoleEditor: {
+		PermAccount, PermUsersRead, PermProfileWrite,
+		PermBlogCreate, PermBlogEdit, PermBlogDelete, PermBlogPublish, PermBlogEditAny, PermBlogTransfer,
+	},
+	RoleAuthor: {
+		PermAccount, PermProfileWrite,
+		PermBlogCreate, PermBlogEdit, PermBlogDelete, PermBlogPublish,
+	},
+	RoleContributor: {
+		PermAccount, PermProfileWrite,
+		PermBlogCreate, PermBlogEdit,
+	},
+}
+
+// Scope limits what a personal access token may do, on top of the role of
+// its owner
+type Scope string
+
+const (
+	ScopeBlogWrite  Scope = "blog:write"
+	ScopeMediaWrite Scope = "media:write"
+	ScopeUsersRead  Scope = "users:read"
+)
+
+var scopePermissions = map[Scope][]Permission{
+	ScopeBlogWrite:  {PermBlogCreate, PermBlogEdit, PermBlogDelete, PermBlogPublish, PermBlogEditAny},
+	ScopeMediaWrite: {PermProfileWrite},
+	ScopeUsersRead:  {PermUsersRead},
+}
+
+func (s Scope) Valid() bool {
+	_, ok := scopePermissions[s]
+	return ok
+}
+
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+func (r Role) Can(perm Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Require lets the request through only when the caller's role grants
+// perm, and the token scopes too for access tokens. It must run after Auth.
+func (ctl *Controller) Require(perm Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := GetPrincipal(c)
+		if principal == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":     "failed",
+				"message":    "not authenticated",
+				"reason":     "unauthenticated",
+				"request_id": c.GetString(logger.RequestIDKey),
+			})
+			c.Abort()
+			return
+		}
+
+		if !principal.Role.Can(perm) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":     "failed",
+				"message":    "you are not allowed to do this",
+				"reason":     "missing_permission",
+				"permission": perm,
+				"role":       principal.Role,
+				"request_id": c.GetString(logger.RequestIDKey),
+			})
+			c.Abort()
+			return
+		}
+
+		// the role allows it, so only the scopes can be in the way
+		if !principal.Can(perm) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":     "failed",
+				"message":    "the access token is not allowed to do this",
+				"reason":     "missing_scope",
+				"permission": perm,
+				"request_id": c.GetString(logger.RequestIDKey),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
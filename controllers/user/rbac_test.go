@@ -0,0 +1,31 @@
+package user
+
+import "testing"
+
+func TestPrincipalCan(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal Principal
+		perm      Permission
+		want      bool
+	}{
+		{"admin manages users", Principal{Role: RoleAdmin}, PermUsersManage, true},
+		{"editor reads users", Principal{Role: RoleEditor}, PermUsersRead, true},
+		{"editor can't manage users", Principal{Role: RoleEditor}, PermUsersManage, false},
+		{"author publishes", Principal{Role: RoleAuthor}, PermBlogPublish, true},
+		{"author edits own posts only", Principal{Role: RoleAuthor}, PermBlogEditAny, false},
+		{"contributor can't publish", Principal{Role: RoleContributor}, PermBlogPublish, false},
+		{"unknown role has nothing", Principal{Role: "root"}, PermAccount, false},
+		{"scope within the role", Principal{Role: RoleAdmin, Scopes: []Scope{ScopeBlogWrite}}, PermBlogEdit, true},
+		{"scope narrows the role", Principal{Role: RoleAdmin, Scopes: []Scope{ScopeBlogWrite}}, PermUsersRead, false},
+		{"scope can't widen the role", Principal{Role: RoleContributor, Scopes: []Scope{ScopeUsersRead}}, PermUsersRead, false},
+		{"no scope grants account", Principal{Role: RoleAdmin, Scopes: []Scope{ScopeBlogWrite, ScopeMediaWrite, ScopeUsersRead}}, PermAccount, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.Can(tt.perm); got != tt.want {
+				t.Fatalf("Can(%s) = %v, want %v", tt.perm, got, tt.want)
+			}
+		})
+	}
+}
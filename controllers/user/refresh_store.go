@@ -0,0 +1,165 @@
+package user
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"fadel-blog-services/configs/store"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RefreshToken is stored hashed. Every refresh spends the token and issues
+// a new one in the same family, so a spent token showing up again means it
+// leaked and the whole family gets revoked.
+type RefreshToken struct {
+	TokenHash string     `bson:"token_hash" json:"-"`
+	FamilyId  string     `bson:"family_id" json:"family_id"`
+	UserId    string     `bson:"user_id" json:"user_id"`
+	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+	ExpiresAt time.Time  `bson:"expires_at" json:"expires_at"`
+	UsedAt    *time.Time `bson:"used_at,omitempty" json:"used_at,omitempty"`
+	RevokedAt *time.Time `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+type RefreshTokenStore interface {
+	Insert(ctx context.Context, token RefreshToken) error
+	FindByHash(ctx context.Context, tokenHash string) (RefreshToken, error)
+	// MarkUsed spends the token, it reports false when it was already spent
+	MarkUsed(ctx context.Context, tokenHash string) (bool, error)
+	RevokeFamily(ctx context.Context, familyId string) error
+	RevokeUser(ctx context.Context, userId string) error
+}
+
+// MongoRefreshTokenStore is the RefreshTokenStore backed by the
+// "refresh_token" collection, expired documents are purged by a ttl index
+type MongoRefreshTokenStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoRefreshTokenStore(db *mongo.Database) *MongoRefreshTokenStore {
+	return &MongoRefreshTokenStore{coll: db.Collection("refresh_token")}
+}
+
+func (s *MongoRefreshTokenStore) Insert(ctx context.Context, token RefreshToken) error {
+	_, err := s.coll.InsertOne(ctx, token)
+	return err
+}
+
+func (s *MongoRefreshTokenStore) FindByHash(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	var token RefreshToken
+	err := s.coll.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return token, store.ErrNotFound
+	}
+
+	return token, err
+}
+
+func (s *MongoRefreshTokenStore) MarkUsed(ctx context.Context, tokenHash string) (bool, error) {
+	// filtering on used_at makes spending atomic, two concurrent refreshes
+	// with the same token can't both win
+	res, err := s.coll.UpdateOne(ctx,
+		bson.M{"token_hash": tokenHash, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return res.ModifiedCount == 1, nil
+}
+
+func (s *MongoRefreshTokenStore) RevokeFamily(ctx context.Context, familyId string) error {
+	_, err := s.coll.UpdateMany(ctx,
+		bson.M{"family_id": familyId, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+func (s *MongoRefreshTokenStore) RevokeUser(ctx context.Context, userId string) error {
+	_, err := s.coll.UpdateMany(ctx,
+		bson.M{"user_id": userId, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+// MemoryRefreshTokenStore is a thread-safe RefreshTokenStore kept in
+// process memory, meant for tests and local development
+type MemoryRefreshTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]RefreshToken
+}
+
+func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{tokens: map[string]RefreshToken{}}
+}
+
+func (s *MemoryRefreshTokenStore) Insert(ctx context.Context, token RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[token.TokenHash]; ok {
+		return store.ErrDuplicate
+	}
+	s.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) FindByHash(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[tokenHash]
+	if !ok {
+		return RefreshToken{}, store.ErrNotFound
+	}
+	return token, nil
+}
+
+func (s *MemoryRefreshTokenStore) MarkUsed(ctx context.Context, tokenHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[tokenHash]
+	if !ok || token.UsedAt != nil {
+		return false, nil
+	}
+
+	now := time.Now()
+	token.UsedAt = &now
+	s.tokens[tokenHash] = token
+	return true, nil
+}
+
+func (s *MemoryRefreshTokenStore) RevokeFamily(ctx context.Context, familyId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for hash, token := range s.tokens {
+		if token.FamilyId == familyId && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			s.tokens[hash] = token
+		}
+	}
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) RevokeUser(ctx context.Context, userId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for hash, token := range s.tokens {
+		if token.UserId == userId && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			s.tokens[hash] = token
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"fadel-blog-services/configs/helpers"
+	"fadel-blog-services/configs/logger"
+	"fadel-blog-services/configs/mailer"
+	"fadel-blog-services/configs/store"
+	"fadel-blog-services/configs/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ForgotPassword mails a reset link to the account with that email. The
+// answer is the same whether or not there is one, so it can't be used to
+// find out which addresses have an account. Requests are throttled per
+// email and per client ip, and a new link replaces the older ones.
+func (ctl *Controller) ForgotPassword(c *gin.Context) {
+	var body ForgotPasswordRequest
+	if err := c.BindJSON(&body); err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
+		return
+	}
+
+	email, err := NormalizeEmail(body.Email)
+	if err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	// every request counts, whether or not the email has an account
+	_, wait, err := ctl.ResetThrottle.Reserve(ctx, email, c.ClientIP())
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if wait > 0 {
+		logger.From(ctx).Warn("password reset throttled", "client_ip", c.ClientIP())
+		sendThrottled(c, "password reset requests", wait)
+		return
+	}
+
+	user, err := ctl.Users.FindByEmail(ctx, email)
+	if err != nil && err != store.ErrNotFound {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	if err == nil && !user.Disabled {
+		plain, hash, err := token.NewOpaque()
+		if err != nil {
+			helpers.SendInternalServerError(c, err)
+			return
+		}
+
+		// only the newest link works
+		if err := ctl.PasswordResets.SpendUser(ctx, user.UserId); err != nil {
+			helpers.SendInternalServerError(c, err)
+			return
+		}
+
+		now := time.Now()
+		err = ctl.PasswordResets.Insert(ctx, PasswordReset{
+			TokenHash: hash,
+			UserId:    user.UserId,
+			CreatedAt: now,
+			ExpiresAt: now.Add(ctl.ResetTTL),
+		})
+		if err != nil {
+			helpers.SendInternalServerError(c, err)
+			return
+		}
+
+		// the mailer only queues the message, a slow smtp server would
+		// otherwise tell existing addresses apart by the response time
+		ctl.mailResetLink(ctx, user, plain)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "if the email belongs to an account, a reset link has been sent to it",
+	})
+}
+
+func (ctl *Controller) mailResetLink(ctx context.Context, user User, plain string) {
+	link, _ := url.Parse(ctl.ResetURL)
+	query := link.Query()
+	query.Set("token", plain)
+	link.RawQuery = query.Encode()
+
+	err := ctl.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nsomeone asked to reset the password of your account. "+
+			"If it was you, open the link below within %v to choose a new one:\n\n%s\n\n"+
+			"Otherwise you can ignore this email, your password stays as it is.\n",
+			user.Username, shortDuration(ctl.ResetTTL), link),
+	})
+	if err != nil {
+		logger.From(ctx).Error("mailing password reset link", "user_id", user.UserId, "error", err)
+	}
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword. The
+// token is spent along with every other one of the user, and all sessions
+// are revoked.
+func (ctl *Controller) ResetPassword(c *gin.Context) {
+	var body ResetPasswordRequest
+	if err := c.BindJSON(&body); err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
+		return
+	}
+
+	ctx := c.Request.Context()
+	hash := token.HashOpaque(body.Token)
+
+	reset, err := ctl.PasswordResets.FindByHash(ctx, hash)
+	if err != nil && err != store.ErrNotFound {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if err == store.ErrNotFound || reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		helpers.SendFailed(c, http.StatusBadRequest, "invalid or expired reset token")
+		return
+	}
+
+	// a rejected password must not burn the token
+	if err := ctl.Passwords.Check(body.NewPassword); err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := ctl.Users.FindById(ctx, reset.UserId)
+	if err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusBadRequest, "invalid or expired reset token")
+			return
+		}
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if user.Disabled {
+		helpers.SendFailed(c, http.StatusForbidden, "account is disabled")
+		return
+	}
+
+	spent, err := ctl.PasswordResets.MarkUsed(ctx, hash)
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if !spent {
+		helpers.SendFailed(c, http.StatusBadRequest, "invalid or expired reset token")
+		return
+	}
+
+	if err := SetPassword(ctx, ctl.Users, ctl.Passwords, user.UserId, body.NewPassword, user.UserId); err != nil {
+		var weak *WeakPasswordError
+		if errors.As(err, &weak) {
+			helpers.SendFailed(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	if err := ctl.PasswordResets.SpendUser(ctx, user.UserId); err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if err := RevokeSessions(ctx, ctl.Revocations, ctl.RefreshTokens, ctl.AccessTokens, ctl.Sessions, user.UserId, ctl.Tokens.TTL); err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	// whoever got locked out by guessing can log in right away
+	if err := ctl.Throttle.Unlock(ctx, user.Username); err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "password reset, please log in with the new one",
+	})
+}
+
+// shortDuration prints 1h instead of 1h0m0s
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
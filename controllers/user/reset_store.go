@@ -0,0 +1,137 @@
+package user
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"fadel-blog-services/configs/store"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PasswordReset is a single-use token mailed to the user, only its hash is
+// stored
+type PasswordReset struct {
+	TokenHash string     `bson:"token_hash" json:"-"`
+	UserId    string     `bson:"user_id" json:"user_id"`
+	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+	ExpiresAt time.Time  `bson:"expires_at" json:"expires_at"`
+	UsedAt    *time.Time `bson:"used_at,omitempty" json:"used_at,omitempty"`
+}
+
+type PasswordResetStore interface {
+	Insert(ctx context.Context, reset PasswordReset) error
+	FindByHash(ctx context.Context, tokenHash string) (PasswordReset, error)
+	// MarkUsed spends the token, it reports false when it was already spent
+	MarkUsed(ctx context.Context, tokenHash string) (bool, error)
+	// SpendUser spends every outstanding token of the user
+	SpendUser(ctx context.Context, userId string) error
+}
+
+// MongoPasswordResetStore is the PasswordResetStore backed by the
+// "password_reset" collection, expired documents are purged by a ttl index
+type MongoPasswordResetStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoPasswordResetStore(db *mongo.Database) *MongoPasswordResetStore {
+	return &MongoPasswordResetStore{coll: db.Collection("password_reset")}
+}
+
+func (s *MongoPasswordResetStore) Insert(ctx context.Context, reset PasswordReset) error {
+	_, err := s.coll.InsertOne(ctx, reset)
+	return err
+}
+
+func (s *MongoPasswordResetStore) FindByHash(ctx context.Context, tokenHash string) (PasswordReset, error) {
+	var reset PasswordReset
+	err := s.coll.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&reset)
+	if err == mongo.ErrNoDocuments {
+		return reset, store.ErrNotFound
+	}
+
+	return reset, err
+}
+
+func (s *MongoPasswordResetStore) MarkUsed(ctx context.Context, tokenHash string) (bool, error) {
+	res, err := s.coll.UpdateOne(ctx,
+		bson.M{"token_hash": tokenHash, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return res.ModifiedCount == 1, nil
+}
+
+func (s *MongoPasswordResetStore) SpendUser(ctx context.Context, userId string) error {
+	_, err := s.coll.UpdateMany(ctx,
+		bson.M{"user_id": userId, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": time.Now()}},
+	)
+	return err
+}
+
+// MemoryPasswordResetStore is a thread-safe PasswordResetStore kept in
+// process memory, meant for tests and local development
+type MemoryPasswordResetStore struct {
+	mu     sync.Mutex
+	resets map[string]PasswordReset
+}
+
+func NewMemoryPasswordResetStore() *MemoryPasswordResetStore {
+	return &MemoryPasswordResetStore{resets: map[string]PasswordReset{}}
+}
+
+func (s *MemoryPasswordResetStore) Insert(ctx context.Context, reset PasswordReset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.resets[reset.TokenHash]; ok {
+		return store.ErrDuplicate
+	}
+	s.resets[reset.TokenHash] = reset
+	return nil
+}
+
+func (s *MemoryPasswordResetStore) FindByHash(ctx context.Context, tokenHash string) (PasswordReset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reset, ok := s.resets[tokenHash]
+	if !ok {
+		return PasswordReset{}, store.ErrNotFound
+	}
+	return reset, nil
+}
+
+func (s *MemoryPasswordResetStore) MarkUsed(ctx context.Context, tokenHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reset, ok := s.resets[tokenHash]
+	if !ok || reset.UsedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	reset.UsedAt = &now
+	s.resets[tokenHash] = reset
+	return true, nil
+}
+
+func (s *MemoryPasswordResetStore) SpendUser(ctx context.Context, userId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for hash, reset := range s.resets {
+		if reset.UserId == userId && reset.UsedAt == nil {
+			reset.UsedAt = &now
+			s.resets[hash] = reset
+		}
+	}
+	return nil
+}
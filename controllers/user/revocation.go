@@ -0,0 +1,288 @@
+package user
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"fadel-blog-services/configs/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Revocation either kills a single access token (Jti set), every token of
+// one session (SessionId set) or every token of a user issued up to
+// RevokedBefore. It is only kept until ExpiresAt, after that the tokens it
+// covers have expired on their own.
+type Revocation struct {
+	Jti           string    `bson:"jti,omitempty"`
+	SessionId     string    `bson:"session_id,omitempty"`
+	UserId        string    `bson:"user_id"`
+	RevokedBefore time.Time `bson:"revoked_before,omitempty"`
+	ExpiresAt     time.Time `bson:"expires_at"`
+}
+
+type RevocationStore interface {
+	Insert(ctx context.Context, revocation Revocation) error
+	// FindActive lists every revocation that hasn't expired yet
+	FindActive(ctx context.Context) ([]Revocation, error)
+}
+
+// MongoRevocationStore is the RevocationStore backed by the
+// "revoked_token" collection, a ttl index purges expired entries
+type MongoRevocationStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoRevocationStore(db *mongo.Database) *MongoRevocationStore {
+	return &MongoRevocationStore{coll: db.Collection("revoked_token")}
+}
+
+func (s *MongoRevocationStore) Insert(ctx context.Context, revocation Revocation) error {
+	_, err := s.coll.InsertOne(ctx, revocation)
+	return err
+}
+
+func (s *MongoRevocationStore) FindActive(ctx context.Context) ([]Revocation, error) {
+	// the ttl monitor only runs every minute, filter the stragglers
+	cursor, err := s.coll.Find(ctx, bson.M{"expires_at": bson.M{"$gt": time.Now()}})
+	if err != nil {
+		return nil, err
+	}
+
+	revocations := []Revocation{}
+	if err := cursor.All(ctx, &revocations); err != nil {
+		return nil, err
+	}
+	return revocations, nil
+}
+
+// MemoryRevocationStore is a thread-safe RevocationStore kept in process
+// memory, meant for tests and local development
+type MemoryRevocationStore struct {
+	mu          sync.Mutex
+	revocations []Revocation
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{}
+}
+
+func (s *MemoryRevocationStore) Insert(ctx context.Context, revocation Revocation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revocations = append(s.revocations, revocation)
+	return nil
+}
+
+func (s *MemoryRevocationStore) FindActive(ctx context.Context) ([]Revocation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	active := []Revocation{}
+	for _, revocation := range s.revocations {
+		if revocation.ExpiresAt.After(now) {
+			active = append(active, revocation)
+		}
+	}
+	return active, nil
+}
+
+// revocationSet is one snapshot of the active revocations
+type revocationSet struct {
+	tokens   map[string]time.Time
+	sessions map[string]time.Time
+	users    map[string]time.Time
+}
+
+func newRevocationSet() *revocationSet {
+	return &revocationSet{
+		tokens:   map[string]time.Time{},
+		sessions: map[string]time.Time{},
+		users:    map[string]time.Time{},
+	}
+}
+
+func (s *revocationSet) add(revocation Revocation) {
+	if revocation.Jti != "" {
+		s.tokens[revocation.Jti] = revocation.ExpiresAt
+		return
+	}
+	if revocation.SessionId != "" {
+		s.sessions[revocation.SessionId] = revocation.ExpiresAt
+		return
+	}
+	if revocation.RevokedBefore.After(s.users[revocation.UserId]) {
+		s.users[revocation.UserId] = revocation.RevokedBefore
+	}
+}
+
+func (s *revocationSet) covers(jti, sessionId, userId string, issuedAt time.Time) bool {
+	if _, ok := s.tokens[jti]; ok && jti != "" {
+		return true
+	}
+	if _, ok := s.sessions[sessionId]; ok && sessionId != "" {
+		return true
+	}
+	// iat has second precision, a token issued in the same second as the
+	// revocation is treated as revoked
+	if before, ok := s.users[userId]; ok && !issuedAt.After(before) {
+		return true
+	}
+	return false
+}
+
+// reloadTimeout bounds a reload, it runs detached from the request that
+// started it
+const reloadTimeout = 10 * time.Second
+
+// RevocationList answers "is this token revoked" from memory. It reloads
+// the whole active list from the store at most once per refresh interval,
+// so a revocation made on another replica takes up to that long to apply.
+// Revocations made through this list apply immediately.
+//
+// Only one reload runs at a time. Requests finding the list stale start it
+// in the background and answer from the previous snapshot meanwhile, only
+// the very first load is waited for.
+type RevocationList struct {
+	store   RevocationStore
+	refresh time.Duration
+
+	mu       sync.RWMutex
+	set      *revocationSet
+	loadedAt time.Time
+	// loading is closed when the reload in flight is done, nil when none
+	// runs. recent are the revocations made through the list since it
+	// started, the reload may have missed them.
+	loading chan struct{}
+	recent  []Revocation
+	loadErr error
+}
+
+func NewRevocationList(store RevocationStore, refresh time.Duration) *RevocationList {
+	return &RevocationList{
+		store:   store,
+		refresh: refresh,
+		set:     newRevocationSet(),
+	}
+}
+
+// startReload starts a reload unless one is running and returns its done
+// channel, l.mu must be held
+func (l *RevocationList) startReload(ctx context.Context) chan struct{} {
+	if l.loading != nil {
+		return l.loading
+	}
+
+	done := make(chan struct{})
+	l.loading, l.recent = done, nil
+	log := logger.From(ctx)
+
+	go func() {
+		defer close(done)
+
+		ctx, cancel := context.WithTimeout(context.Background(), reloadTimeout)
+		defer cancel()
+		revocations, err := l.store.FindActive(ctx)
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.loading, l.loadErr = nil, err
+		if err != nil {
+			// loadedAt stays old, the next request tries again
+			log.Error("reloading revocation list", "error", err)
+			l.recent = nil
+			return
+		}
+
+		set := newRevocationSet()
+		for _, revocation := range append(revocations, l.recent...) {
+			set.add(revocation)
+		}
+		l.set, l.loadedAt, l.recent = set, time.Now(), nil
+	}()
+
+	return done
+}
+
+// IsRevoked reports whether the token with this jti, issued in sessionId to
+// userId at issuedAt, has been revoked
+func (l *RevocationList) IsRevoked(ctx context.Context, jti, sessionId, userId string, issuedAt time.Time) (bool, error) {
+	l.mu.RLock()
+	stale := time.Since(l.loadedAt) > l.refresh
+	loaded := !l.loadedAt.IsZero()
+	l.mu.RUnlock()
+
+	if stale {
+		l.mu.Lock()
+		done := l.startReload(ctx)
+		l.mu.Unlock()
+
+		// without a first snapshot there is nothing to answer from
+		if !loaded {
+			select {
+			case <-done:
+			case <-ctx.Done():
+				return false, ctx.Err()
+			}
+		}
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.loadedAt.IsZero() {
+		return false, l.loadErr
+	}
+	return l.set.covers(jti, sessionId, userId, issuedAt), nil
+}
+
+// revoked applies a revocation already stored
+func (l *RevocationList) revoked(revocation Revocation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.set.add(revocation)
+	if l.loading != nil {
+		l.recent = append(l.recent, revocation)
+	}
+}
+
+// RevokeToken kills one access token until it would have expired anyway
+func (l *RevocationList) RevokeToken(ctx context.Context, jti, userId string, expiresAt time.Time) error {
+	revocation := Revocation{Jti: jti, UserId: userId, ExpiresAt: expiresAt}
+	if err := l.store.Insert(ctx, revocation); err != nil {
+		return err
+	}
+
+	l.revoked(revocation)
+	return nil
+}
+
+// RevokeSession kills every access token of one session. maxTTL is the
+// access token lifetime, the session can't have newer ones.
+func (l *RevocationList) RevokeSession(ctx context.Context, sessionId, userId string, maxTTL time.Duration) error {
+	revocation := Revocation{SessionId: sessionId, UserId: userId, ExpiresAt: time.Now().Add(maxTTL)}
+	if err := l.store.Insert(ctx, revocation); err != nil {
+		return err
+	}
+
+	l.revoked(revocation)
+	return nil
+}
+
+// RevokeUser kills every access token issued to userId so far. maxTTL is
+// the access token lifetime, older tokens can't be valid anymore.
+func (l *RevocationList) RevokeUser(ctx context.Context, userId string, maxTTL time.Duration) error {
+	now := time.Now().Truncate(time.Second)
+	revocation := Revocation{UserId: userId, RevokedBefore: now, ExpiresAt: now.Add(maxTTL)}
+	if err := l.store.Insert(ctx, revocation); err != nil {
+		return err
+	}
+
+	l.revoked(revocation)
+	return nil
+}
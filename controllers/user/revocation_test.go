@@ -0,0 +1,105 @@
+package user
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gatedRevocationStore counts the reloads and holds each one until gate
+// lets it through
+type gatedRevocationStore struct {
+	*MemoryRevocationStore
+	gate  chan struct{}
+	loads int32
+}
+
+func (s *gatedRevocationStore) FindActive(ctx context.Context) ([]Revocation, error) {
+	atomic.AddInt32(&s.loads, 1)
+	<-s.gate
+	return s.MemoryRevocationStore.FindActive(ctx)
+}
+
+func TestRevocationListSingleReload(t *testing.T) {
+	ctx := context.Background()
+	store := &gatedRevocationStore{MemoryRevocationStore: NewMemoryRevocationStore(), gate: make(chan struct{})}
+	store.Insert(ctx, Revocation{Jti: "old", UserId: "u1", ExpiresAt: time.Now().Add(time.Hour)})
+	list := NewRevocationList(store, time.Hour)
+
+	// the first load is waited for, by everyone at once
+	var wg sync.WaitGroup
+	results := make([]bool, 20)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = list.IsRevoked(ctx, "old", "", "u1", time.Now())
+		}(i)
+	}
+	for atomic.LoadInt32(&store.loads) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(store.gate)
+	wg.Wait()
+
+	if store.loads != 1 {
+		t.Fatalf("%d loads, want 1", store.loads)
+	}
+	for i, revoked := range results {
+		if !revoked {
+			t.Fatalf("caller %d missed the revocation", i)
+		}
+	}
+}
+
+func TestRevocationListStaleSnapshot(t *testing.T) {
+	ctx := context.Background()
+	store := &gatedRevocationStore{MemoryRevocationStore: NewMemoryRevocationStore(), gate: make(chan struct{}, 1)}
+	list := NewRevocationList(store, time.Hour)
+
+	store.gate <- struct{}{}
+	if revoked, err := list.IsRevoked(ctx, "a", "", "u1", time.Now()); err != nil || revoked {
+		t.Fatalf("first load: %v %v", revoked, err)
+	}
+
+	// another replica revokes, then the list goes stale and reloads in the
+	// background while stale answers keep coming from the old snapshot
+	store.Insert(ctx, Revocation{Jti: "a", UserId: "u1", ExpiresAt: time.Now().Add(time.Hour)})
+	list.mu.Lock()
+	list.refresh = 0
+	list.mu.Unlock()
+
+	for i := 0; i < 10; i++ {
+		if revoked, err := list.IsRevoked(ctx, "a", "", "u1", time.Now()); err != nil || revoked {
+			t.Fatalf("stale answer %d: %v %v", i, revoked, err)
+		}
+	}
+	for atomic.LoadInt32(&store.loads) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	list.IsRevoked(ctx, "a", "", "u1", time.Now())
+	if loads := atomic.LoadInt32(&store.loads); loads != 2 {
+		t.Fatalf("%d loads, want 2", loads)
+	}
+
+	// a local revocation made while the reload runs survives the swap
+	if err := list.RevokeToken(ctx, "b", "u1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	list.mu.RLock()
+	done := list.loading
+	list.mu.RUnlock()
+	store.gate <- struct{}{}
+	<-done
+
+	list.mu.Lock()
+	list.refresh = time.Hour
+	list.mu.Unlock()
+	for _, jti := range []string{"a", "b"} {
+		if revoked, err := list.IsRevoked(ctx, jti, "", "u1", time.Now()); err != nil || !revoked {
+			t.Fatalf("%s after reload: %v %v", jti, revoked, err)
+		}
+	}
+}
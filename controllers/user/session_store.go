@@ -0,0 +1,222 @@
+package user
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"fadel-blog-services/configs/store"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// how a session was started
+const (
+	MethodPassword = "password"
+	MethodOIDC     = "oidc"
+	MethodToken    = "token"
+)
+
+// Session is one login, kept as login history until PurgeAt. Password and
+// oidc sessions are a refresh token family and share its id, token sessions
+// are the use of a personal access token and share the token's id.
+type Session struct {
+	SessionId  string     `bson:"session_id" json:"id"`
+	UserId     string     `bson:"user_id" json:"user_id"`
+	Method     string     `bson:"method" json:"method"`
+	IP         string     `bson:"ip" json:"ip"`
+	UserAgent  string     `bson:"user_agent" json:"user_agent"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	LastSeenAt time.Time  `bson:"last_seen_at" json:"last_seen_at"`
+	ExpiresAt  time.Time  `bson:"expires_at" json:"expires_at"`
+	EndedAt    *time.Time `bson:"ended_at,omitempty" json:"ended_at,omitempty"`
+	PurgeAt    time.Time  `bson:"purge_at" json:"-"`
+}
+
+// Active reports whether the session can still be used
+func (s Session) Active(now time.Time) bool {
+	return s.EndedAt == nil && now.Before(s.ExpiresAt)
+}
+
+type SessionStore interface {
+	Insert(ctx context.Context, session Session) error
+	Find(ctx context.Context, sessionId string) (Session, error)
+	// FindByUser lists the sessions of a user, newest first
+	FindByUser(ctx context.Context, userId string) ([]Session, error)
+	// Seen records another use of the session, from ip and userAgent
+	Seen(ctx context.Context, sessionId, ip, userAgent string, at, expiresAt time.Time) error
+	// End closes the session, it reports false when it was closed already
+	End(ctx context.Context, sessionId string, at time.Time) (bool, error)
+	// EndUser closes every open session of the user
+	EndUser(ctx context.Context, userId string, at time.Time) error
+}
+
+// MongoSessionStore is the SessionStore backed by the "session" collection,
+// a ttl index on purge_at drops old history
+type MongoSessionStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoSessionStore(db *mongo.Database) *MongoSessionStore {
+	return &MongoSessionStore{coll: db.Collection("session")}
+}
+
+func (s *MongoSessionStore) Insert(ctx context.Context, session Session) error {
+	_, err := s.coll.InsertOne(ctx, session)
+	if mongo.IsDuplicateKeyError(err) {
+		return store.ErrDuplicate
+	}
+
+	return err
+}
+
+func (s *MongoSessionStore) Find(ctx context.Context, sessionId string) (Session, error) {
+	var session Session
+	err := s.coll.FindOne(ctx, bson.M{"session_id": sessionId}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return session, store.ErrNotFound
+	}
+
+	return session, err
+}
+
+func (s *MongoSessionStore) FindByUser(ctx context.Context, userId string) ([]Session, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{"user_id": userId}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{}
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (s *MongoSessionStore) Seen(ctx context.Context, sessionId, ip, userAgent string, at, expiresAt time.Time) error {
+	res, err := s.coll.UpdateOne(ctx, bson.M{"session_id": sessionId}, bson.M{"$set": bson.M{
+		"ip":           ip,
+		"user_agent":   userAgent,
+		"last_seen_at": at,
+		"expires_at":   expiresAt,
+	}})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *MongoSessionStore) End(ctx context.Context, sessionId string, at time.Time) (bool, error) {
+	res, err := s.coll.UpdateOne(ctx,
+		bson.M{"session_id": sessionId, "ended_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"ended_at": at}},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return res.ModifiedCount == 1, nil
+}
+
+func (s *MongoSessionStore) EndUser(ctx context.Context, userId string, at time.Time) error {
+	_, err := s.coll.UpdateMany(ctx,
+		bson.M{"user_id": userId, "ended_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"ended_at": at}},
+	)
+	return err
+}
+
+// MemorySessionStore is a thread-safe SessionStore kept in process memory,
+// meant for tests and local development
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: map[string]Session{}}
+}
+
+func (s *MemorySessionStore) Insert(ctx context.Context, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[session.SessionId]; ok {
+		return store.ErrDuplicate
+	}
+	s.sessions[session.SessionId] = session
+	return nil
+}
+
+func (s *MemorySessionStore) Find(ctx context.Context, sessionId string) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionId]
+	if !ok {
+		return Session{}, store.ErrNotFound
+	}
+	return session, nil
+}
+
+func (s *MemorySessionStore) FindByUser(ctx context.Context, userId string) ([]Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := []Session{}
+	for _, session := range s.sessions {
+		if session.UserId == userId {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+	return sessions, nil
+}
+
+func (s *MemorySessionStore) Seen(ctx context.Context, sessionId, ip, userAgent string, at, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionId]
+	if !ok {
+		return store.ErrNotFound
+	}
+	session.IP, session.UserAgent, session.LastSeenAt, session.ExpiresAt = ip, userAgent, at, expiresAt
+	s.sessions[sessionId] = session
+	return nil
+}
+
+func (s *MemorySessionStore) End(ctx context.Context, sessionId string, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionId]
+	if !ok || session.EndedAt != nil {
+		return false, nil
+	}
+	session.EndedAt = &at
+	s.sessions[sessionId] = session
+	return true, nil
+}
+
+func (s *MemorySessionStore) EndUser(ctx context.Context, userId string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if session.UserId == userId && session.EndedAt == nil {
+			session.EndedAt = &at
+			s.sessions[id] = session
+		}
+	}
+	return nil
+}
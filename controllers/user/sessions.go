@@ -0,0 +1,166 @@
+package user
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"fadel-blog-services/configs/helpers"
+	"fadel-blog-services/configs/logger"
+	"fadel-blog-services/configs/store"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// startSession records a login by method and returns the id of its session
+func (ctl *Controller) startSession(c *gin.Context, user User, method string) (string, error) {
+	ctx := c.Request.Context()
+
+	sessionId, err := helpers.CreateUUIDStr()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	err = ctl.Sessions.Insert(ctx, Session{
+		SessionId:  sessionId,
+		UserId:     user.UserId,
+		Method:     method,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(ctl.RefreshTTL),
+		PurgeAt:    now.Add(ctl.LoginHistoryRetention),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := ctl.Users.Update(ctx, user.UserId, bson.M{"last_login_at": now}); err != nil {
+		return "", err
+	}
+	return sessionId, nil
+}
+
+// seenAccessToken records a use of a personal access token in the session
+// named after it, the first use starts that session
+func (ctl *Controller) seenAccessToken(c *gin.Context, accessToken AccessToken) error {
+	ctx := c.Request.Context()
+	now := time.Now()
+
+	err := ctl.Sessions.Seen(ctx, accessToken.TokenId, c.ClientIP(), c.Request.UserAgent(), now, accessToken.ExpiresAt)
+	if err != store.ErrNotFound {
+		return err
+	}
+
+	err = ctl.Sessions.Insert(ctx, Session{
+		SessionId:  accessToken.TokenId,
+		UserId:     accessToken.UserId,
+		Method:     MethodToken,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  accessToken.ExpiresAt,
+		PurgeAt:    now.Add(ctl.LoginHistoryRetention),
+	})
+	if err != nil && err != store.ErrDuplicate {
+		return err
+	}
+
+	return ctl.Users.Update(ctx, accessToken.UserId, bson.M{"last_login_at": now})
+}
+
+// endSession revokes the refresh token family and the access tokens of a
+// password or oidc session and closes it
+func (ctl *Controller) endSession(ctx context.Context, sessionId, userId string) error {
+	if err := ctl.RefreshTokens.RevokeFamily(ctx, sessionId); err != nil {
+		return err
+	}
+
+	if err := ctl.Revocations.RevokeSession(ctx, sessionId, userId, ctl.Tokens.TTL); err != nil {
+		return err
+	}
+
+	_, err := ctl.Sessions.End(ctx, sessionId, time.Now())
+	return err
+}
+
+// GetSessions lists the caller's login history, marking the sessions that
+// can still be used and the one of this request
+func (ctl *Controller) GetSessions(c *gin.Context) {
+	caller := MustPrincipal(c)
+
+	sessions, err := ctl.Sessions.FindByUser(c.Request.Context(), caller.UserId)
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	current := caller.SessionId
+	if caller.AccessTokenId != "" {
+		current = caller.AccessTokenId
+	}
+
+	now := time.Now()
+	data := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		data = append(data, gin.H{
+			"id":           session.SessionId,
+			"method":       session.Method,
+			"ip":           session.IP,
+			"user_agent":   session.UserAgent,
+			"created_at":   session.CreatedAt,
+			"last_seen_at": session.LastSeenAt,
+			"expires_at":   session.ExpiresAt,
+			"ended_at":     session.EndedAt,
+			"active":       session.Active(now),
+			"current":      session.SessionId == current,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   data,
+	})
+}
+
+// DeleteSession ends one of the caller's sessions. Ending a token session
+// deletes the personal access token.
+func (ctl *Controller) DeleteSession(c *gin.Context) {
+	caller := MustPrincipal(c)
+	ctx := c.Request.Context()
+	sessionId := c.Param("id")
+
+	session, err := ctl.Sessions.Find(ctx, sessionId)
+	if err != nil && err != store.ErrNotFound {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	// other users' sessions don't exist as far as the caller knows
+	if err == store.ErrNotFound || session.UserId != caller.UserId {
+		helpers.SendFailed(c, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if session.Method == MethodToken {
+		err = ctl.AccessTokens.Delete(ctx, caller.UserId, session.SessionId)
+		if err == nil || err == store.ErrNotFound {
+			_, err = ctl.Sessions.End(ctx, session.SessionId, time.Now())
+		}
+	} else {
+		err = ctl.endSession(ctx, session.SessionId, caller.UserId)
+	}
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	logger.From(ctx).Info("session ended", "session_id", session.SessionId, "method", session.Method)
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "session ended",
+	})
+}
@@ -0,0 +1,288 @@
+package user
+
+import (
+	"context"
+	"sync"
+
+	"fadel-blog-services/configs/store"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// UserStore covers every query the user handlers run against storage.
+type UserStore interface {
+	FindAll(ctx context.Context) ([]User, error)
+	FindById(ctx context.Context, userId string) (User, error)
+	FindByUsername(ctx context.Context, username string) (User, error)
+	FindByEmail(ctx context.Context, email string) (User, error)
+	FindByOIDC(ctx context.Context, issuer, subject string) (User, error)
+	Insert(ctx context.Context, user User) error
+	Update(ctx context.Context, userId string, set bson.M) error
+	// SpendTOTPStep records step as the last used totp step unless it isn't
+	// newer than the stored one, reporting whether it did
+	SpendTOTPStep(ctx context.Context, userId string, step int64) (bool, error)
+	// SpendRecoveryCode removes the recovery code hash, reporting whether the
+	// user still had it
+	SpendRecoveryCode(ctx context.Context, userId, hash string) (bool, error)
+	Delete(ctx context.Context, userId string) error
+}
+
+// MongoStore is the UserStore backed by the "user" collection.
+type MongoStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{coll: db.Collection("user")}
+}
+
+func (s *MongoStore) FindAll(ctx context.Context) ([]User, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	users := []User{}
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (s *MongoStore) findOne(ctx context.Context, filter bson.M) (User, error) {
+	var user User
+	err := s.coll.FindOne(ctx, filter).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, store.ErrNotFound
+	}
+
+	return user, err
+}
+
+func (s *MongoStore) FindById(ctx context.Context, userId string) (User, error) {
+	return s.findOne(ctx, bson.M{"user_id": userId})
+}
+
+func (s *MongoStore) FindByUsername(ctx context.Context, username string) (User, error) {
+	return s.findOne(ctx, bson.M{"username": username})
+}
+
+func (s *MongoStore) FindByEmail(ctx context.Context, email string) (User, error) {
+	return s.findOne(ctx, bson.M{"email": email})
+}
+
+func (s *MongoStore) FindByOIDC(ctx context.Context, issuer, subject string) (User, error) {
+	return s.findOne(ctx, bson.M{"oidc_issuer": issuer, "oidc_subject": subject})
+}
+
+func (s *MongoStore) Insert(ctx context.Context, user User) error {
+	_, err := s.coll.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return store.ErrDuplicate
+	}
+
+	return err
+}
+
+func (s *MongoStore) Update(ctx context.Context, userId string, set bson.M) error {
+	res, err := s.coll.UpdateOne(ctx, bson.M{"user_id": userId}, bson.M{"$set": set})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return store.ErrDuplicate
+		}
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+// the filter makes both spends atomic, two logins racing with the same code
+// can't both match
+func (s *MongoStore) SpendTOTPStep(ctx context.Context, userId string, step int64) (bool, error) {
+	filter := bson.M{
+		"user_id": userId,
+		"$or": bson.A{
+			bson.M{"totp_last_step": bson.M{"$lt": step}},
+			bson.M{"totp_last_step": bson.M{"$exists": false}},
+		},
+	}
+	res, err := s.coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"totp_last_step": step}})
+	if err != nil {
+		return false, err
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
+func (s *MongoStore) SpendRecoveryCode(ctx context.Context, userId, hash string) (bool, error) {
+	filter := bson.M{"user_id": userId, "recovery_codes": hash}
+	res, err := s.coll.UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"recovery_codes": hash}})
+	if err != nil {
+		return false, err
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
+func (s *MongoStore) Delete(ctx context.Context, userId string) error {
+	res, err := s.coll.DeleteOne(ctx, bson.M{"user_id": userId})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+// MemoryStore is a thread-safe UserStore kept in process memory, meant for
+// tests and local development.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	users []User
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) FindAll(ctx context.Context) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]User, len(s.users))
+	copy(users, s.users)
+	return users, nil
+}
+
+func (s *MemoryStore) indexOf(match func(User) bool) int {
+	for i, user := range s.users {
+		if match(user) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *MemoryStore) findOne(match func(User) bool) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := s.indexOf(match)
+	if i < 0 {
+		return User{}, store.ErrNotFound
+	}
+	return s.users[i], nil
+}
+
+func (s *MemoryStore) FindById(ctx context.Context, userId string) (User, error) {
+	return s.findOne(func(u User) bool { return u.UserId == userId })
+}
+
+func (s *MemoryStore) FindByUsername(ctx context.Context, username string) (User, error) {
+	return s.findOne(func(u User) bool { return u.Username == username })
+}
+
+func (s *MemoryStore) FindByEmail(ctx context.Context, email string) (User, error) {
+	return s.findOne(func(u User) bool { return email != "" && u.Email == email })
+}
+
+func (s *MemoryStore) FindByOIDC(ctx context.Context, issuer, subject string) (User, error) {
+	return s.findOne(func(u User) bool { return subject != "" && u.OIDCIssuer == issuer && u.OIDCSubject == subject })
+}
+
+func (s *MemoryStore) Insert(ctx context.Context, user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	duplicate := func(u User) bool {
+		return u.UserId == user.UserId || u.Username == user.Username || (user.Email != "" && u.Email == user.Email) ||
+			(user.OIDCSubject != "" && u.OIDCIssuer == user.OIDCIssuer && u.OIDCSubject == user.OIDCSubject)
+	}
+	if s.indexOf(duplicate) >= 0 {
+		return store.ErrDuplicate
+	}
+
+	s.users = append(s.users, user)
+	return nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, userId string, set bson.M) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOf(func(u User) bool { return u.UserId == userId })
+	if i < 0 {
+		return store.ErrNotFound
+	}
+
+	updated := s.users[i]
+	if err := store.ApplySet(&updated, set); err != nil {
+		return err
+	}
+
+	// the unique indexes of the mongo collection
+	duplicate := func(u User) bool {
+		return u.UserId != userId && (u.Username == updated.Username || (updated.Email != "" && u.Email == updated.Email) ||
+			(updated.OIDCSubject != "" && u.OIDCIssuer == updated.OIDCIssuer && u.OIDCSubject == updated.OIDCSubject))
+	}
+	if s.indexOf(duplicate) >= 0 {
+		return store.ErrDuplicate
+	}
+
+	s.users[i] = updated
+	return nil
+}
+
+func (s *MemoryStore) SpendTOTPStep(ctx context.Context, userId string, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOf(func(u User) bool { return u.UserId == userId })
+	if i < 0 || s.users[i].TOTPLastStep >= step {
+		return false, nil
+	}
+
+	s.users[i].TOTPLastStep = step
+	return true, nil
+}
+
+func (s *MemoryStore) SpendRecoveryCode(ctx context.Context, userId, hash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOf(func(u User) bool { return u.UserId == userId })
+	if i < 0 {
+		return false, nil
+	}
+
+	codes := s.users[i].RecoveryCodes
+	for j, stored := range codes {
+		if stored == hash {
+			s.users[i].RecoveryCodes = append(append([]string{}, codes[:j]...), codes[j+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, userId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOf(func(u User) bool { return u.UserId == userId })
+	if i < 0 {
+		return store.ErrNotFound
+	}
+
+	s.users = append(s.users[:i], s.users[i+1:]...)
+	return nil
+}
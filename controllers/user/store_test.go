@@ -0,0 +1,106 @@
+package user
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMemoryStoreSpendTOTPStep(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryStore()
+	if err := users.Insert(ctx, User{UserId: "u1", Username: "alice", TOTPLastStep: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		userId string
+		step   int64
+		want   bool
+	}{
+		{"older step", "u1", 9, false},
+		{"stored step", "u1", 10, false},
+		{"newer step", "u1", 11, true},
+		{"same step again", "u1", 11, false},
+		{"unknown user", "u2", 12, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := users.SpendTOTPStep(ctx, tt.userId, tt.step)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.want {
+				t.Fatalf("got %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreSpendRecoveryCode(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryStore()
+	if err := users.Insert(ctx, User{UserId: "u1", Username: "alice", RecoveryCodes: []string{"a", "b", "c"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{"unused code", "b", true},
+		{"spent code", "b", false},
+		{"unknown code", "z", false},
+		{"another code", "a", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := users.SpendRecoveryCode(ctx, "u1", tt.hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.want {
+				t.Fatalf("got %v, want %v", ok, tt.want)
+			}
+		})
+	}
+
+	user, err := users.FindById(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.RecoveryCodes) != 1 || user.RecoveryCodes[0] != "c" {
+		t.Fatalf("recovery codes left %v", user.RecoveryCodes)
+	}
+}
+
+func TestMemoryStoreSpendRace(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryStore()
+	if err := users.Insert(ctx, User{UserId: "u1", Username: "alice", RecoveryCodes: []string{"a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var steps, codes int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := users.SpendTOTPStep(ctx, "u1", 42); ok {
+				atomic.AddInt32(&steps, 1)
+			}
+			if ok, _ := users.SpendRecoveryCode(ctx, "u1", "a"); ok {
+				atomic.AddInt32(&codes, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if steps != 1 || codes != 1 {
+		t.Fatalf("step spent %d times, recovery code %d times", steps, codes)
+	}
+}
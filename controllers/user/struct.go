@@ -8,13 +8,39 @@ type Authentication struct {
 }
 
 type User struct {
-	UserId            string    `bson:"user_id,omitempty" json:"user_id"`
-	Fullname          string    `bson:"full_name,omitempty" json:"full_name"`
-	Username          string    `bson:"username,omitempty" json:"username"`
-	Password          string    `bson:"password,omitempty" json:"password,omitempty"`
-	ProfilePictureURL string    `bson:"profile_picture_url,omitempty" json:"profile_picture_url"`
-	PhoneNumber       string    `bson:"phone_number,omitempty" json:"phone_number"`
-	CreatedAt         time.Time `bson:"created_at,omitempty" json:"created_at"`
-	UpdatedAt         time.Time `bson:"updated_at,omitempty" json:"updated_at"`
-	UpdatedBy         string    `bson:"updated_by,omitempty" json:"updated_by"`
+	UserId            string     `bson:"user_id,omitempty" json:"user_id"`
+	Fullname          string     `bson:"full_name,omitempty" json:"full_name"`
+	Username          string     `bson:"username,omitempty" json:"username"`
+	Email             string     `bson:"email,omitempty" json:"email"`
+	Password          string     `bson:"password,omitempty" json:"password,omitempty"`
+	ProfilePictureURL string     `bson:"profile_picture_url,omitempty" json:"profile_picture_url"`
+	PhoneNumber       string     `bson:"phone_number,omitempty" json:"phone_number"`
+	Role              Role       `bson:"role,omitempty" json:"role"`
+	CreatedAt         time.Time  `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt         time.Time  `bson:"updated_at,omitempty" json:"updated_at"`
+	UpdatedBy         string     `bson:"updated_by,omitempty" json:"updated_by"`
+	Disabled          bool       `bson:"disabled,omitempty" json:"disabled"`
+	LastLoginAt       *time.Time `bson:"last_login_at,omitempty" json:"last_login_at"`
+	// second factor, see two_factor.go. Only TOTPEnabled is ever sent out.
+	TOTPEnabled       bool     `bson:"totp_enabled,omitempty" json:"totp_enabled"`
+	TOTPSecret        string   `bson:"totp_secret,omitempty" json:"-"`
+	TOTPPendingSecret string   `bson:"totp_pending_secret,omitempty" json:"-"`
+	TOTPLastStep      int64    `bson:"totp_last_step,omitempty" json:"-"`
+	RecoveryCodes     []string `bson:"recovery_codes,omitempty" json:"-"`
+	// identity provider account linked by oidc login, see oidc.go
+	OIDCIssuer  string `bson:"oidc_issuer,omitempty" json:"-"`
+	OIDCSubject string `bson:"oidc_subject,omitempty" json:"-"`
+}
+
+// EditUserRequest is all PATCH /users/edit/:id may change, nil fields are
+// kept. Passwords, 2fa and the profile picture have endpoints of their own.
+type EditUserRequest struct {
+	Fullname    *string `json:"full_name"`
+	Username    *string `json:"username"`
+	Email       *string `json:"email"`
+	PhoneNumber *string `json:"phone_number"`
+	Role        *Role   `json:"role"`
+	Disabled    *bool   `json:"disabled"`
+	// only read to turn a password away with a hint
+	Password string `json:"password"`
 }
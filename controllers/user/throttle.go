@@ -0,0 +1,253 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fadel-blog-services/configs/helpers"
+	"fadel-blog-services/configs/logger"
+	"fadel-blog-services/configs/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reasons recorded on LoginFailure
+const (
+	ReasonUnknownUser   = "unknown_user"
+	ReasonWrongPassword = "wrong_password"
+	ReasonThrottled     = "throttled"
+	ReasonWrongCode     = "wrong_2fa_code"
+	// ReasonWrongCurrentPassword is a failed proof of the password on
+	// POST /password/change, Username holds the user id then
+	ReasonWrongCurrentPassword = "wrong_current_password"
+)
+
+type ThrottleOptions struct {
+	// KeyPrefix sets the counters of this throttle apart from the others
+	// sharing the LoginAttemptStore
+	KeyPrefix string
+	// MaxUserFailures and MaxIPFailures are the failures within Window
+	// after which the username or the ip is locked out for Lockout
+	MaxUserFailures int
+	MaxIPFailures   int
+	// Backoff is the wait after the first failure, it doubles with every
+	// further one up to Lockout
+	Backoff        time.Duration
+	Lockout        time.Duration
+	Window         time.Duration
+	AuditRetention time.Duration
+}
+
+// LoginThrottle slows down password guessing. Failures are counted per
+// username and per client ip in the LoginAttemptStore, so every replica
+// sees the same counters and lockouts survive restarts.
+type LoginThrottle struct {
+	attempts LoginAttemptStore
+	opts     ThrottleOptions
+}
+
+func NewLoginThrottle(attempts LoginAttemptStore, opts ThrottleOptions) *LoginThrottle {
+	return &LoginThrottle{attempts: attempts, opts: opts}
+}
+
+func userKey(username string) string {
+	return "user:" + username
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+type throttleLimit struct {
+	key string
+	max int
+}
+
+func (t *LoginThrottle) limits(username, ip string) []throttleLimit {
+	return []throttleLimit{
+		{t.opts.KeyPrefix + userKey(username), t.opts.MaxUserFailures},
+		{t.opts.KeyPrefix + ipKey(ip), t.opts.MaxIPFailures},
+	}
+}
+
+// LoginAttempt is a login attempt claimed by Reserve
+type LoginAttempt struct {
+	claims []attemptClaim
+}
+
+// attemptClaim is the counter of one key before and after Reserve
+type attemptClaim struct {
+	previous *LoginCounter
+	claimed  LoginCounter
+}
+
+// Reserve claims a login attempt for username and ip before the password
+// is checked. The attempt counts as a failure right away, so a burst of
+// concurrent guesses can't all slip through before the first is recorded;
+// Success gives it back. A refused attempt gets how long to wait.
+func (t *LoginThrottle) Reserve(ctx context.Context, username, ip string) (*LoginAttempt, time.Duration, error) {
+	attempt := &LoginAttempt{}
+	for _, limit := range t.limits(username, ip) {
+		claim, wait, err := t.reserve(ctx, limit)
+		if err == nil && wait == 0 {
+			attempt.claims = append(attempt.claims, claim)
+			continue
+		}
+
+		// the keys claimed so far are given back
+		for _, claimed := range attempt.claims {
+			if releaseErr := t.attempts.Release(ctx, claimed.claimed, claimed.previous); releaseErr != nil && err == nil {
+				err = releaseErr
+			}
+		}
+		return nil, wait, err
+	}
+
+	return attempt, 0, nil
+}
+
+// reserve counts an attempt on one key, unless it has to wait
+func (t *LoginThrottle) reserve(ctx context.Context, limit throttleLimit) (attemptClaim, time.Duration, error) {
+	for {
+		now := time.Now()
+		next := LoginCounter{Key: limit.key, Failures: 1, LastFailureAt: now}
+
+		var previous *LoginCounter
+		counter, err := t.attempts.Find(ctx, limit.key)
+		if err != nil && err != store.ErrNotFound {
+			return attemptClaim{}, 0, err
+		}
+		if err == nil {
+			if wait := t.wait(counter, limit.max, now); wait > 0 {
+				return attemptClaim{}, wait, nil
+			}
+			previous = &counter
+			if counter.LastFailureAt.After(now.Add(-t.opts.Window)) {
+				next.Failures = counter.Failures + 1
+			}
+		}
+
+		next.ExpiresAt = now.Add(t.opts.Window)
+		if lock := now.Add(t.opts.Lockout); next.Failures >= limit.max && lock.After(next.ExpiresAt) {
+			next.ExpiresAt = lock
+		}
+
+		swapped, err := t.attempts.Swap(ctx, previous, next)
+		if err != nil {
+			return attemptClaim{}, 0, err
+		}
+		if swapped {
+			return attemptClaim{previous: previous, claimed: next}, 0, nil
+		}
+		// another attempt got in first, its backoff applies on the next round
+	}
+}
+
+// wait is how long a key with counter has to wait at now. Once it has max
+// failures it is locked out for Lockout after the last one.
+func (t *LoginThrottle) wait(counter LoginCounter, max int, now time.Time) time.Duration {
+	until := counter.LastFailureAt.Add(t.backoff(counter.Failures))
+	if lock := counter.LastFailureAt.Add(t.opts.Lockout); counter.Failures >= max && lock.After(until) {
+		until = lock
+	}
+	// locks written before attempts were reserved
+	if counter.LockedUntil != nil && counter.LockedUntil.After(until) {
+		until = *counter.LockedUntil
+	}
+	return until.Sub(now)
+}
+
+func (t *LoginThrottle) backoff(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	// past 30 doublings any sane Backoff is beyond Lockout anyway
+	if failures > 30 {
+		return t.opts.Lockout
+	}
+
+	d := t.opts.Backoff << (failures - 1)
+	if d > t.opts.Lockout {
+		d = t.opts.Lockout
+	}
+	return d
+}
+
+// Failure writes the audit record, Reserve already counted the attempt
+func (t *LoginThrottle) Failure(ctx context.Context, failure LoginFailure) error {
+	now := time.Now()
+	failure.At = now
+	failure.ExpiresAt = now.Add(t.opts.AuditRetention)
+	return t.attempts.Audit(ctx, failure)
+}
+
+// Success clears the failures of the username and gives the attempt back
+// to the ip. The ip keeps its older failures, or a single known account
+// would let one client guess at all the others.
+func (t *LoginThrottle) Success(ctx context.Context, attempt *LoginAttempt) error {
+	userClaim, ipClaim := attempt.claims[0], attempt.claims[1]
+	if err := t.attempts.Reset(ctx, userClaim.claimed.Key); err != nil {
+		return err
+	}
+	return t.attempts.Release(ctx, ipClaim.claimed, ipClaim.previous)
+}
+
+// Unlock lifts the lockout and the backoff of username
+func (t *LoginThrottle) Unlock(ctx context.Context, username string) error {
+	return t.attempts.Reset(ctx, t.opts.KeyPrefix+userKey(username))
+}
+
+// loginFailed records a failed login, a failure to record it is only logged
+// since the client gets turned away in any case
+func (ctl *Controller) loginFailed(c *gin.Context, username, reason string) {
+	l := logger.From(c.Request.Context())
+	l.Warn("login failed", "username", username, "client_ip", c.ClientIP(), "reason", reason)
+
+	err := ctl.Throttle.Failure(c.Request.Context(), LoginFailure{
+		Username:  username,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Reason:    reason,
+		RequestId: c.GetString(logger.RequestIDKey),
+	})
+	if err != nil {
+		l.Error("recording login failure", "error", err)
+	}
+}
+
+// sendThrottled answers a request that came before its backoff or lockout
+// ended, what names what was attempted too often
+func sendThrottled(c *gin.Context, what string, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	helpers.SendFailed(c, http.StatusTooManyRequests, fmt.Sprintf("too many %s, try again in %d seconds", what, seconds))
+}
+
+// UnlockUser clears the failed logins of an account, ending its lockout
+func (ctl *Controller) UnlockUser(c *gin.Context) {
+	userId := c.Param("id")
+
+	user, err := ctl.Users.FindById(c.Request.Context(), userId)
+	if err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusNotFound, "user not found")
+			return
+		}
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	if err := ctl.Throttle.Unlock(c.Request.Context(), user.Username); err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "user unlocked",
+	})
+}
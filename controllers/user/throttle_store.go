@@ -0,0 +1,217 @@
+package user
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"fadel-blog-services/configs/store"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// LoginCounter tracks the failed logins of one key, "user:<username>" or
+// "ip:<address>". It is dropped once ExpiresAt has passed. LockedUntil is
+// only left on counters from before lockouts were derived from Failures.
+type LoginCounter struct {
+	Key           string     `bson:"key" json:"key"`
+	Failures      int        `bson:"failures" json:"failures"`
+	LastFailureAt time.Time  `bson:"last_failure_at" json:"last_failure_at"`
+	LockedUntil   *time.Time `bson:"locked_until,omitempty" json:"locked_until,omitempty"`
+	ExpiresAt     time.Time  `bson:"expires_at" json:"expires_at"`
+}
+
+// LoginFailure is the audit record of one failed or refused login
+type LoginFailure struct {
+	Username  string    `bson:"username" json:"username"`
+	IP        string    `bson:"ip" json:"ip"`
+	UserAgent string    `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	Reason    string    `bson:"reason" json:"reason"`
+	RequestId string    `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	At        time.Time `bson:"at" json:"at"`
+	ExpiresAt time.Time `bson:"expires_at" json:"-"`
+}
+
+type LoginAttemptStore interface {
+	// Find returns store.ErrNotFound when the key has no counter
+	Find(ctx context.Context, key string) (LoginCounter, error)
+	// Swap replaces the counter of next.Key with next if it is still
+	// previous (nil for no counter). It reports false when another attempt
+	// changed it first.
+	Swap(ctx context.Context, previous *LoginCounter, next LoginCounter) (bool, error)
+	// Release gives back the attempt that turned previous into claimed:
+	// previous is restored while the counter is still claimed, otherwise
+	// one failure is taken off
+	Release(ctx context.Context, claimed LoginCounter, previous *LoginCounter) error
+	Reset(ctx context.Context, key string) error
+	Audit(ctx context.Context, failure LoginFailure) error
+}
+
+// MongoLoginAttemptStore keeps counters in "login_counter" and the audit
+// trail in "login_failure", both purged by ttl indexes on expires_at
+type MongoLoginAttemptStore struct {
+	counters *mongo.Collection
+	failures *mongo.Collection
+}
+
+func NewMongoLoginAttemptStore(db *mongo.Database) *MongoLoginAttemptStore {
+	return &MongoLoginAttemptStore{
+		counters: db.Collection("login_counter"),
+		failures: db.Collection("login_failure"),
+	}
+}
+
+func (s *MongoLoginAttemptStore) Find(ctx context.Context, key string) (LoginCounter, error) {
+	var counter LoginCounter
+	err := s.counters.FindOne(ctx, bson.M{"key": key}).Decode(&counter)
+	if err == mongo.ErrNoDocuments {
+		return counter, store.ErrNotFound
+	}
+
+	return counter, err
+}
+
+func (s *MongoLoginAttemptStore) Swap(ctx context.Context, previous *LoginCounter, next LoginCounter) (bool, error) {
+	if previous == nil {
+		// the unique index on key lets only one of concurrent inserts win
+		_, err := s.counters.InsertOne(ctx, next)
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	res, err := s.counters.ReplaceOne(ctx, bson.M{
+		"key":             previous.Key,
+		"failures":        previous.Failures,
+		"last_failure_at": previous.LastFailureAt,
+	}, next)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+func (s *MongoLoginAttemptStore) Release(ctx context.Context, claimed LoginCounter, previous *LoginCounter) error {
+	unchanged := bson.M{
+		"key":             claimed.Key,
+		"failures":        claimed.Failures,
+		"last_failure_at": claimed.LastFailureAt,
+	}
+
+	var matched int64
+	if previous == nil {
+		res, err := s.counters.DeleteOne(ctx, unchanged)
+		if err != nil {
+			return err
+		}
+		matched = res.DeletedCount
+	} else {
+		res, err := s.counters.ReplaceOne(ctx, unchanged, previous)
+		if err != nil {
+			return err
+		}
+		matched = res.MatchedCount
+	}
+	if matched == 1 {
+		return nil
+	}
+
+	_, err := s.counters.UpdateOne(ctx,
+		bson.M{"key": claimed.Key, "failures": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"failures": -1}},
+	)
+	return err
+}
+
+func (s *MongoLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	_, err := s.counters.DeleteOne(ctx, bson.M{"key": key})
+	return err
+}
+
+func (s *MongoLoginAttemptStore) Audit(ctx context.Context, failure LoginFailure) error {
+	_, err := s.failures.InsertOne(ctx, failure)
+	return err
+}
+
+// MemoryLoginAttemptStore is a thread-safe LoginAttemptStore kept in
+// process memory, meant for tests and local development
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	counters map[string]LoginCounter
+	failures []LoginFailure
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{counters: map[string]LoginCounter{}}
+}
+
+func (s *MemoryLoginAttemptStore) Find(ctx context.Context, key string) (LoginCounter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, ok := s.counters[key]
+	if !ok || time.Now().After(counter.ExpiresAt) {
+		return LoginCounter{}, store.ErrNotFound
+	}
+	return counter, nil
+}
+
+func (s *MemoryLoginAttemptStore) Swap(ctx context.Context, previous *LoginCounter, next LoginCounter) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.counters[next.Key]
+	if previous == nil {
+		if ok && time.Now().Before(current.ExpiresAt) {
+			return false, nil
+		}
+	} else if !ok || current.Failures != previous.Failures || !current.LastFailureAt.Equal(previous.LastFailureAt) {
+		return false, nil
+	}
+
+	s.counters[next.Key] = next
+	return true, nil
+}
+
+func (s *MemoryLoginAttemptStore) Release(ctx context.Context, claimed LoginCounter, previous *LoginCounter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, ok := s.counters[claimed.Key]
+	if !ok {
+		return nil
+	}
+
+	if counter.Failures == claimed.Failures && counter.LastFailureAt.Equal(claimed.LastFailureAt) {
+		if previous == nil {
+			delete(s.counters, claimed.Key)
+		} else {
+			s.counters[claimed.Key] = *previous
+		}
+		return nil
+	}
+
+	if counter.Failures > 0 {
+		counter.Failures--
+		s.counters[claimed.Key] = counter
+	}
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.counters, key)
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Audit(ctx context.Context, failure LoginFailure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, failure)
+	return nil
+}
@@ -0,0 +1,136 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestThrottle(opts ThrottleOptions) *LoginThrottle {
+	return NewLoginThrottle(NewMemoryLoginAttemptStore(), opts)
+}
+
+func TestThrottleBackoff(t *testing.T) {
+	throttle := newTestThrottle(ThrottleOptions{Backoff: time.Second, Lockout: time.Minute})
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{7, time.Minute},
+		{64, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := throttle.backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestThrottleReserve(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		// attempts are (username, ip) pairs reserved in order, wantRefused
+		// are the indexes that have to wait
+		attempts    [][2]string
+		wantRefused map[int]bool
+	}{
+		{
+			name:        "username locked after max failures",
+			attempts:    [][2]string{{"ann", "ip1"}, {"ann", "ip2"}, {"ann", "ip3"}, {"ann", "ip4"}},
+			wantRefused: map[int]bool{3: true},
+		},
+		{
+			name:        "ip locked after max failures",
+			attempts:    [][2]string{{"a", "ip1"}, {"b", "ip1"}, {"c", "ip1"}, {"d", "ip1"}, {"e", "ip1"}, {"f", "ip1"}},
+			wantRefused: map[int]bool{5: true},
+		},
+		{
+			name:        "other usernames and ips are unaffected",
+			attempts:    [][2]string{{"ann", "ip1"}, {"ann", "ip1"}, {"ann", "ip1"}, {"bob", "ip2"}},
+			wantRefused: map[int]bool{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := newTestThrottle(ThrottleOptions{
+				MaxUserFailures: 3,
+				MaxIPFailures:   5,
+				Lockout:         time.Minute,
+				Window:          time.Minute,
+			})
+			for i, attempt := range tt.attempts {
+				_, wait, err := throttle.Reserve(ctx, attempt[0], attempt[1])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if refused := wait > 0; refused != tt.wantRefused[i] {
+					t.Fatalf("attempt %d %v refused=%v (wait %v)", i, attempt, refused, wait)
+				}
+			}
+		})
+	}
+}
+
+func TestThrottleRefusedAttemptReleasesUsername(t *testing.T) {
+	ctx := context.Background()
+	throttle := newTestThrottle(ThrottleOptions{MaxUserFailures: 5, MaxIPFailures: 1, Lockout: time.Minute, Window: time.Minute})
+
+	if _, wait, err := throttle.Reserve(ctx, "ann", "ip1"); err != nil || wait > 0 {
+		t.Fatal(wait, err)
+	}
+	// ip1 is locked now, the claim on bob must be given back
+	if _, wait, err := throttle.Reserve(ctx, "bob", "ip1"); err != nil || wait == 0 {
+		t.Fatal(wait, err)
+	}
+	if _, err := throttle.attempts.Find(ctx, userKey("bob")); err == nil {
+		t.Fatal("refused attempt still counted against bob")
+	}
+}
+
+func TestThrottleSuccess(t *testing.T) {
+	ctx := context.Background()
+	throttle := newTestThrottle(ThrottleOptions{MaxUserFailures: 2, MaxIPFailures: 10, Lockout: time.Minute, Window: time.Minute})
+
+	if _, _, err := throttle.Reserve(ctx, "ann", "ip1"); err != nil {
+		t.Fatal(err)
+	}
+	attempt, wait, err := throttle.Reserve(ctx, "ann", "ip1")
+	if err != nil || wait > 0 {
+		t.Fatal(wait, err)
+	}
+	if err := throttle.Success(ctx, attempt); err != nil {
+		t.Fatal(err)
+	}
+
+	// the username starts over, the ip keeps its earlier failure only
+	if _, err := throttle.attempts.Find(ctx, userKey("ann")); err == nil {
+		t.Fatal("username failures kept after a success")
+	}
+	counter, err := throttle.attempts.Find(ctx, ipKey("ip1"))
+	if err != nil || counter.Failures != 1 {
+		t.Fatalf("ip counter %+v, %v", counter, err)
+	}
+}
+
+func TestThrottleKeyPrefix(t *testing.T) {
+	ctx := context.Background()
+	attempts := NewMemoryLoginAttemptStore()
+	opts := ThrottleOptions{MaxUserFailures: 1, MaxIPFailures: 10, Lockout: time.Minute, Window: time.Minute}
+	logins := NewLoginThrottle(attempts, opts)
+	opts.KeyPrefix = "reset:"
+	resets := NewLoginThrottle(attempts, opts)
+
+	if _, wait, err := resets.Reserve(ctx, "ann", "ip1"); err != nil || wait > 0 {
+		t.Fatal(wait, err)
+	}
+	if _, wait, err := logins.Reserve(ctx, "ann", "ip1"); err != nil || wait > 0 {
+		t.Fatalf("reset requests locked the login: %v %v", wait, err)
+	}
+}
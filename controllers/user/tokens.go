@@ -0,0 +1,234 @@
+package user
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"fadel-blog-services/configs/helpers"
+	"fadel-blog-services/configs/logger"
+	"fadel-blog-services/configs/store"
+	"fadel-blog-services/configs/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// issueTokens mints an access token and a refresh token for the session
+// sessionId, which is also the id of the refresh token family
+func (ctl *Controller) issueTokens(ctx context.Context, user User, sessionId string) (gin.H, error) {
+	accessToken, expiresAt, err := ctl.Tokens.Issue(user.UserId, user.Username, string(user.Role), sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshHash, err := token.NewOpaque()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ctl.RefreshTokens.Insert(ctx, RefreshToken{
+		TokenHash: refreshHash,
+		FamilyId:  sessionId,
+		UserId:    user.UserId,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(ctl.RefreshTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"token":         accessToken,
+		"expires_at":    expiresAt,
+		"refresh_token": refreshToken,
+	}, nil
+}
+
+// RefreshToken trades a refresh token for a new access/refresh token pair.
+// The presented token is spent, presenting it again revokes its family.
+// Without a body the refresh cookie is used and the new pair set as cookies.
+func (ctl *Controller) RefreshToken(c *gin.Context) {
+	var body RefreshRequest
+	cookie, err := c.Cookie(RefreshCookie)
+	fromCookie := err == nil && ctl.Cookies.Enabled && c.Request.ContentLength == 0
+	if fromCookie {
+		if !checkCSRF(c) {
+			helpers.SendFailed(c, http.StatusForbidden, "missing or invalid csrf token")
+			return
+		}
+		body.RefreshToken = cookie
+	} else if err := c.BindJSON(&body); err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
+		return
+	}
+
+	ctx := c.Request.Context()
+	hash := token.HashOpaque(body.RefreshToken)
+
+	stored, err := ctl.RefreshTokens.FindByHash(ctx, hash)
+	if err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusUnauthorized, "invalid refresh token")
+			return
+		}
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		helpers.SendFailed(c, http.StatusUnauthorized, "refresh token expired or revoked")
+		return
+	}
+
+	spent, err := ctl.RefreshTokens.MarkUsed(ctx, hash)
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if !spent {
+		// somebody already used this token, either the client or whoever stole it
+		logger.From(ctx).Warn("refresh token reuse, revoking family", "family_id", stored.FamilyId, "user_id", stored.UserId)
+		if err := ctl.endSession(ctx, stored.FamilyId, stored.UserId); err != nil {
+			helpers.SendInternalServerError(c, err)
+			return
+		}
+		helpers.SendFailed(c, http.StatusUnauthorized, "refresh token reuse detected, please log in again")
+		return
+	}
+
+	user, err := ctl.Users.FindById(ctx, stored.UserId)
+	if err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusUnauthorized, "invalid refresh token")
+			return
+		}
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if user.Disabled {
+		helpers.SendFailed(c, http.StatusForbidden, "account is disabled")
+		return
+	}
+
+	tokens, err := ctl.issueTokens(ctx, user, stored.FamilyId)
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	if fromCookie {
+		if err := ctl.sendCookies(c, tokens); err != nil {
+			helpers.SendInternalServerError(c, err)
+			return
+		}
+	}
+
+	// families from before login history was kept have no session
+	now := time.Now()
+	err = ctl.Sessions.Seen(ctx, stored.FamilyId, c.ClientIP(), c.Request.UserAgent(), now, now.Add(ctl.RefreshTTL))
+	if err != nil && err != store.ErrNotFound {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   tokens,
+	})
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Logout revokes the access token of the request and, when given, the
+// refresh token family it came with
+func (ctl *Controller) Logout(c *gin.Context) {
+	caller := MustPrincipal(c)
+	ctx := c.Request.Context()
+
+	// the body is optional
+	var body LogoutRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
+			return
+		}
+	}
+
+	err := ctl.Revocations.RevokeToken(ctx, caller.TokenId, caller.UserId, caller.ExpiresAt)
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	// a cookie session can't hand in its refresh token, it ends by its id
+	if _, err := c.Cookie(SessionCookie); err == nil && ctl.Cookies.Enabled {
+		if caller.SessionId != "" {
+			if err := ctl.endSession(ctx, caller.SessionId, caller.UserId); err != nil {
+				helpers.SendInternalServerError(c, err)
+				return
+			}
+		}
+		ctl.clearCookies(c)
+	}
+
+	if body.RefreshToken != "" {
+		stored, err := ctl.RefreshTokens.FindByHash(ctx, token.HashOpaque(body.RefreshToken))
+		if err != nil && err != store.ErrNotFound {
+			helpers.SendInternalServerError(c, err)
+			return
+		}
+
+		// only the owner may revoke a family
+		if err == nil && stored.UserId == caller.UserId {
+			if err := ctl.endSession(ctx, stored.FamilyId, stored.UserId); err != nil {
+				helpers.SendInternalServerError(c, err)
+				return
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "logged out successfully",
+	})
+}
+
+// RevokeUserSessions logs a user out everywhere: every access token issued
+// so far and every refresh token stop working, personal access tokens are
+// deleted
+func (ctl *Controller) RevokeUserSessions(c *gin.Context) {
+	userId := c.Param("id")
+
+	if _, err := ctl.Users.FindById(c.Request.Context(), userId); err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusNotFound, "user not found")
+			return
+		}
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	if err := RevokeSessions(c.Request.Context(), ctl.Revocations, ctl.RefreshTokens, ctl.AccessTokens, ctl.Sessions, userId, ctl.Tokens.TTL); err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "all sessions of the user revoked",
+	})
+}
+
+// GetJWKS publishes the public keys access tokens are signed with, so other
+// services can verify them without a shared secret. It is a plain JWK Set,
+// not wrapped like the other responses.
+func (ctl *Controller) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, ctl.Tokens.Keys.PublicKeys())
+}
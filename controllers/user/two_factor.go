@@ -0,0 +1,490 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"net/http"
+	"strings"
+	"time"
+
+	"fadel-blog-services/configs/helpers"
+	"fadel-blog-services/configs/store"
+	"fadel-blog-services/configs/token"
+	"fadel-blog-services/configs/totp"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	recoveryCodeCount = 10
+	// codes from one step before or after are accepted too, for clock drift
+	totpSkew = 1
+)
+
+// TwoFactorRequest is the body of every 2fa endpoint, each one reads the
+// fields it needs
+type TwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+	Password       string `json:"password"`
+}
+
+type TwoFactorSettingsRequest struct {
+	RequiredRoles []Role `json:"required_roles" binding:"required"`
+}
+
+// requiresTwoFactor reports whether user has to pass a second factor at login
+func (ctl *Controller) requiresTwoFactor(c *gin.Context, user User) (bool, error) {
+	if user.TOTPEnabled {
+		return true, nil
+	}
+
+	settings, err := ctl.TwoFactorSettings.Get(c.Request.Context())
+	if err != nil {
+		return false, err
+	}
+	return settings.Requires(user.Role), nil
+}
+
+// sendChallenge answers a login by method whose first factor was right but
+// that still needs a code, or the enrolment of one when the role requires it
+func (ctl *Controller) sendChallenge(c *gin.Context, user User, method string) {
+	challenge, expiresAt, err := ctl.Tokens.IssueChallenge(user.UserId, method, ctl.ChallengeTTL)
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"two_factor_required": true,
+			"setup_required":      !user.TOTPEnabled,
+			"challenge_token":     challenge,
+			"expires_at":          expiresAt,
+		},
+	})
+}
+
+// challengedUser loads the user a challenge token was issued to and the
+// login method it continues
+func (ctl *Controller) challengedUser(c *gin.Context, challenge string) (User, string, bool) {
+	userId, method, err := ctl.Tokens.VerifyChallenge(challenge)
+	if err != nil {
+		helpers.SendFailed(c, http.StatusUnauthorized, "invalid or expired challenge, please log in again")
+		return User{}, "", false
+	}
+
+	user, err := ctl.Users.FindById(c.Request.Context(), userId)
+	if err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusUnauthorized, "invalid or expired challenge, please log in again")
+			return User{}, "", false
+		}
+		helpers.SendInternalServerError(c, err)
+		return User{}, "", false
+	}
+	if user.Disabled {
+		helpers.SendFailed(c, http.StatusForbidden, "account is disabled")
+		return User{}, "", false
+	}
+
+	// challenges from before the method was recorded only came from /login
+	if method == "" {
+		method = MethodPassword
+	}
+	return user, method, true
+}
+
+// currentUser loads the caller of an authenticated request
+func (ctl *Controller) currentUser(c *gin.Context) (User, bool) {
+	caller := MustPrincipal(c)
+
+	user, err := ctl.Users.FindById(c.Request.Context(), caller.UserId)
+	if err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusUnauthorized, "user not found")
+			return User{}, false
+		}
+		helpers.SendInternalServerError(c, err)
+		return User{}, false
+	}
+	return user, true
+}
+
+// checkSecondFactor accepts a current totp code or an unused recovery code,
+// spending whichever was given
+func (ctl *Controller) checkSecondFactor(c *gin.Context, user User, code, recoveryCode string) (bool, error) {
+	ctx := c.Request.Context()
+
+	if code != "" {
+		step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), totpSkew, user.TOTPLastStep)
+		if !ok {
+			return false, nil
+		}
+		// user was read before the code was checked, a concurrent login may
+		// have spent the same step since
+		return ctl.Users.SpendTOTPStep(ctx, user.UserId, step)
+	}
+
+	if recoveryCode != "" {
+		return ctl.Users.SpendRecoveryCode(ctx, user.UserId, hashRecoveryCode(recoveryCode))
+	}
+
+	return false, nil
+}
+
+// newRecoveryCodes returns codes to show the user once and the hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores case, dashes and spaces so codes can be typed
+// however they were written down
+func hashRecoveryCode(code string) string {
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	return token.HashOpaque(code)
+}
+
+// beginEnrollment stores a new pending secret and sends its provisioning uri
+func (ctl *Controller) beginEnrollment(c *gin.Context, user User) {
+	if user.TOTPEnabled {
+		helpers.SendFailed(c, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	if err := ctl.Users.Update(c.Request.Context(), user.UserId, bson.M{"totp_pending_secret": secret}); err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"secret":           secret,
+			"provisioning_uri": totp.URI(ctl.TOTPIssuer, user.Username, secret),
+		},
+	})
+}
+
+// confirmEnrollment turns 2fa on once the first code from the app matches
+// the pending secret, and returns the recovery codes
+func (ctl *Controller) confirmEnrollment(c *gin.Context, user User, code string) ([]string, bool) {
+	if user.TOTPEnabled {
+		helpers.SendFailed(c, http.StatusConflict, "two-factor authentication is already enabled")
+		return nil, false
+	}
+	if user.TOTPPendingSecret == "" {
+		helpers.SendFailed(c, http.StatusBadRequest, "two-factor setup has not been started")
+		return nil, false
+	}
+
+	step, ok := totp.Validate(user.TOTPPendingSecret, code, time.Now(), totpSkew, 0)
+	if !ok {
+		helpers.SendFailed(c, http.StatusBadRequest, "invalid code")
+		return nil, false
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return nil, false
+	}
+
+	err = ctl.Users.Update(c.Request.Context(), user.UserId, bson.M{
+		"totp_enabled":        true,
+		"totp_secret":         user.TOTPPendingSecret,
+		"totp_pending_secret": "",
+		"totp_last_step":      step,
+		"recovery_codes":      hashes,
+		"updated_at":          time.Now(),
+		"updated_by":          user.UserId,
+	})
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return nil, false
+	}
+
+	return codes, true
+}
+
+// clearTwoFactor turns 2fa off for userId
+func (ctl *Controller) clearTwoFactor(c *gin.Context, userId, updatedBy string) error {
+	return ctl.Users.Update(c.Request.Context(), userId, bson.M{
+		"totp_enabled":        false,
+		"totp_secret":         "",
+		"totp_pending_secret": "",
+		"totp_last_step":      int64(0),
+		"recovery_codes":      []string{},
+		"updated_at":          time.Now(),
+		"updated_by":          updatedBy,
+	})
+}
+
+// LoginTwoFactor trades the challenge from Login and a totp or recovery
+// code for the real tokens
+func (ctl *Controller) LoginTwoFactor(c *gin.Context) {
+	var body TwoFactorRequest
+	if err := c.BindJSON(&body); err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
+		return
+	}
+
+	user, method, ok := ctl.challengedUser(c, body.ChallengeToken)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		helpers.SendFailed(c, http.StatusBadRequest, "two-factor authentication is not set up, use /login/2fa/setup")
+		return
+	}
+
+	// six digits are quickly guessed, codes count against the same limits as passwords
+	attempt, wait, err := ctl.Throttle.Reserve(c.Request.Context(), user.Username, c.ClientIP())
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if wait > 0 {
+		ctl.loginFailed(c, user.Username, ReasonThrottled)
+		sendThrottled(c, "failed login attempts", wait)
+		return
+	}
+
+	ok, err = ctl.checkSecondFactor(c, user, body.Code, body.RecoveryCode)
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if !ok {
+		ctl.loginFailed(c, user.Username, ReasonWrongCode)
+		helpers.SendFailed(c, http.StatusUnauthorized, "invalid code")
+		return
+	}
+
+	if err := ctl.Throttle.Success(c.Request.Context(), attempt); err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	ctl.completeLogin(c, user, method, nil)
+}
+
+// LoginTwoFactorSetup starts the enrolment of a user whose role requires
+// 2fa, before they have any other token
+func (ctl *Controller) LoginTwoFactorSetup(c *gin.Context) {
+	var body TwoFactorRequest
+	if err := c.BindJSON(&body); err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
+		return
+	}
+
+	user, _, ok := ctl.challengedUser(c, body.ChallengeToken)
+	if !ok {
+		return
+	}
+
+	ctl.beginEnrollment(c, user)
+}
+
+// LoginTwoFactorConfirm finishes the enrolment started by
+// LoginTwoFactorSetup and logs the user in
+func (ctl *Controller) LoginTwoFactorConfirm(c *gin.Context) {
+	var body TwoFactorRequest
+	if err := c.BindJSON(&body); err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
+		return
+	}
+
+	user, method, ok := ctl.challengedUser(c, body.ChallengeToken)
+	if !ok {
+		return
+	}
+
+	codes, ok := ctl.confirmEnrollment(c, user, body.Code)
+	if !ok {
+		return
+	}
+
+	ctl.completeLogin(c, user, method, gin.H{"recovery_codes": codes})
+}
+
+// SetupTwoFactor starts the enrolment of the caller
+func (ctl *Controller) SetupTwoFactor(c *gin.Context) {
+	user, ok := ctl.currentUser(c)
+	if !ok {
+		return
+	}
+
+	ctl.beginEnrollment(c, user)
+}
+
+// ConfirmTwoFactor turns on 2fa for the caller
+func (ctl *Controller) ConfirmTwoFactor(c *gin.Context) {
+	var body TwoFactorRequest
+	if err := c.BindJSON(&body); err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
+		return
+	}
+
+	user, ok := ctl.currentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, ok := ctl.confirmEnrollment(c, user, body.Code)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "two-factor authentication enabled, store the recovery codes somewhere safe",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// DisableTwoFactor turns off 2fa for the caller, who has to prove both the
+// password and the second factor
+func (ctl *Controller) DisableTwoFactor(c *gin.Context) {
+	var body TwoFactorRequest
+	if err := c.BindJSON(&body); err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
+		return
+	}
+
+	user, ok := ctl.currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		helpers.SendFailed(c, http.StatusBadRequest, "two-factor authentication is not enabled")
+		return
+	}
+
+	settings, err := ctl.TwoFactorSettings.Get(c.Request.Context())
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if settings.Requires(user.Role) {
+		helpers.SendFailed(c, http.StatusForbidden, "two-factor authentication is required for your role")
+		return
+	}
+
+	if !CheckPasswordHash(body.Password, user.Password) {
+		helpers.SendFailed(c, http.StatusBadRequest, ErrWrongPassword.Error())
+		return
+	}
+	ok, err = ctl.checkSecondFactor(c, user, body.Code, body.RecoveryCode)
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if !ok {
+		helpers.SendFailed(c, http.StatusBadRequest, "invalid code")
+		return
+	}
+
+	if err := ctl.clearTwoFactor(c, user.UserId, user.UserId); err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "two-factor authentication disabled",
+	})
+}
+
+// ResetUserTwoFactor removes 2fa from an account that lost its device, its
+// owner enrols again at the next login when the role requires it
+func (ctl *Controller) ResetUserTwoFactor(c *gin.Context) {
+	caller := MustPrincipal(c)
+	userId := c.Param("id")
+
+	err := ctl.clearTwoFactor(c, userId, caller.UserId)
+	if err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusNotFound, "user not found")
+			return
+		}
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "two-factor authentication of the user reset",
+	})
+}
+
+func (ctl *Controller) GetTwoFactorSettings(c *gin.Context) {
+	settings, err := ctl.TwoFactorSettings.Get(c.Request.Context())
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   settings,
+	})
+}
+
+// UpdateTwoFactorSettings sets the roles that need 2fa. Sessions opened
+// before keep working until they expire.
+func (ctl *Controller) UpdateTwoFactorSettings(c *gin.Context) {
+	caller := MustPrincipal(c)
+
+	var body TwoFactorSettingsRequest
+	if err := c.BindJSON(&body); err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
+		return
+	}
+
+	for _, role := range body.RequiredRoles {
+		if !role.Valid() {
+			helpers.SendFailed(c, http.StatusBadRequest, ErrInvalidRole.Error())
+			return
+		}
+	}
+
+	settings := TwoFactorSettings{
+		RequiredRoles: body.RequiredRoles,
+		UpdatedAt:     time.Now(),
+		UpdatedBy:     caller.UserId,
+	}
+	if err := ctl.TwoFactorSettings.Save(c.Request.Context(), settings); err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   settings,
+	})
+}
@@ -0,0 +1,86 @@
+package user
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TwoFactorSettings lists the roles whose accounts can't log in without a
+// second factor
+type TwoFactorSettings struct {
+	RequiredRoles []Role    `bson:"required_roles" json:"required_roles"`
+	UpdatedAt     time.Time `bson:"updated_at,omitempty" json:"updated_at"`
+	UpdatedBy     string    `bson:"updated_by,omitempty" json:"updated_by"`
+}
+
+// Requires reports whether accounts with role need a second factor
+func (s TwoFactorSettings) Requires(role Role) bool {
+	for _, required := range s.RequiredRoles {
+		if required == role {
+			return true
+		}
+	}
+	return false
+}
+
+type TwoFactorSettingsStore interface {
+	// Get returns empty settings when none were saved yet
+	Get(ctx context.Context) (TwoFactorSettings, error)
+	Save(ctx context.Context, settings TwoFactorSettings) error
+}
+
+// MongoTwoFactorSettingsStore keeps the settings as the "two_factor"
+// document of the "setting" collection
+type MongoTwoFactorSettingsStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoTwoFactorSettingsStore(db *mongo.Database) *MongoTwoFactorSettingsStore {
+	return &MongoTwoFactorSettingsStore{coll: db.Collection("setting")}
+}
+
+func (s *MongoTwoFactorSettingsStore) Get(ctx context.Context) (TwoFactorSettings, error) {
+	var settings TwoFactorSettings
+	err := s.coll.FindOne(ctx, bson.M{"_id": "two_factor"}).Decode(&settings)
+	if err == mongo.ErrNoDocuments {
+		return TwoFactorSettings{RequiredRoles: []Role{}}, nil
+	}
+
+	return settings, err
+}
+
+func (s *MongoTwoFactorSettingsStore) Save(ctx context.Context, settings TwoFactorSettings) error {
+	_, err := s.coll.ReplaceOne(ctx, bson.M{"_id": "two_factor"}, settings, options.Replace().SetUpsert(true))
+	return err
+}
+
+// MemoryTwoFactorSettingsStore is a thread-safe TwoFactorSettingsStore kept
+// in process memory, meant for tests and local development
+type MemoryTwoFactorSettingsStore struct {
+	mu       sync.Mutex
+	settings TwoFactorSettings
+}
+
+func NewMemoryTwoFactorSettingsStore() *MemoryTwoFactorSettingsStore {
+	return &MemoryTwoFactorSettingsStore{settings: TwoFactorSettings{RequiredRoles: []Role{}}}
+}
+
+func (s *MemoryTwoFactorSettingsStore) Get(ctx context.Context) (TwoFactorSettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.settings, nil
+}
+
+func (s *MemoryTwoFactorSettingsStore) Save(ctx context.Context, settings TwoFactorSettings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settings = settings
+	return nil
+}
@@ -1,139 +1,228 @@
 package user
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"fadel-blog-services/configs/db"
 	"fadel-blog-services/configs/helpers"
-	"fadel-blog-services/configs/minio"
+	"fadel-blog-services/configs/logger"
+	"fadel-blog-services/configs/mailer"
+	"fadel-blog-services/configs/oidc"
+	"fadel-blog-services/configs/storage"
+	"fadel-blog-services/configs/store"
+	"fadel-blog-services/configs/token"
 
-	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
-	miniosdk "github.com/minio/minio-go/v7"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var userColl = db.DB.Collection("user")
+type Controller struct {
+	Users         UserStore
+	RefreshTokens RefreshTokenStore
+	Objects       storage.ObjectStore
+	Passwords     *PasswordPolicy
+	Throttle      *LoginThrottle
+	// PasswordThrottle limits guesses at the current password of
+	// ChangePassword, per user id
+	PasswordThrottle *LoginThrottle
+	Revocations      *RevocationList
+	Tokens           *token.Issuer
+	RefreshTTL       time.Duration
+
+	// PasswordResets, ResetThrottle, Mailer, ResetURL and ResetTTL serve
+	// the forgotten password flow
+	PasswordResets PasswordResetStore
+	ResetThrottle  *LoginThrottle
+	Mailer         mailer.Mailer
+	ResetURL       string
+	ResetTTL       time.Duration
+
+	// TwoFactorSettings, TOTPIssuer and ChallengeTTL serve two-factor logins
+	TwoFactorSettings TwoFactorSettingsStore
+	TOTPIssuer        string
+	ChallengeTTL      time.Duration
+
+	// AccessTokens are the personal access tokens Auth accepts besides jwts
+	AccessTokens      AccessTokenStore
+	AccessTokenMaxTTL time.Duration
+
+	// Cookies configure the cookie session mode for browsers
+	Cookies CookieOptions
+
+	// Sessions keep the login history for LoginHistoryRetention
+	Sessions              SessionStore
+	LoginHistoryRetention time.Duration
+
+	// OIDC is nil unless login through the identity provider is configured
+	OIDC              *oidc.Provider
+	OIDCLogins        OIDCLoginStore
+	OIDCLoginTTL      time.Duration
+	OIDCDefaultRole   Role
+	OIDCAutoProvision bool
+	OIDCLinkByEmail   bool
+}
 
 func CheckPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
 
-func Login(c *gin.Context) {
+func (ctl *Controller) Login(c *gin.Context) {
 	var userData Authentication
-	var user User
 
 	if err := c.BindJSON(&userData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "failed",
-			"message": "can't bind struct",
-		})
-		c.Abort()
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
 		return
 	}
 
-	var error = userColl.FindOne(context.Background(), bson.M{"username": userData.Username}).Decode(&user)
-	if error != nil {
-		// check if there's an error, maybe due to wrong username
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "failed",
-			"message": "Invalid username or password",
-		})
-		c.Abort()
+	// throttled attempts are refused before the password is even looked at
+	attempt, wait, err := ctl.Throttle.Reserve(c.Request.Context(), userData.Username, c.ClientIP())
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if wait > 0 {
+		ctl.loginFailed(c, userData.Username, ReasonThrottled)
+		sendThrottled(c, "failed login attempts", wait)
+		return
+	}
+
+	user, err := ctl.Users.FindByUsername(c.Request.Context(), userData.Username)
+	if err != nil {
+		if err != store.ErrNotFound {
+			helpers.SendInternalServerError(c, err)
+			return
+		}
+		ctl.loginFailed(c, userData.Username, ReasonUnknownUser)
+		helpers.SendFailed(c, http.StatusOK, "Invalid username or password")
 		return
 	}
 
 	if !CheckPasswordHash(userData.Password, user.Password) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "failed",
-			"message": "Invalid username or password",
-		})
-		c.Abort()
+		ctl.loginFailed(c, userData.Username, ReasonWrongPassword)
+		helpers.SendFailed(c, http.StatusOK, "Invalid username or password")
+		return
+	}
+
+	if err := ctl.Throttle.Success(c.Request.Context(), attempt); err != nil {
+		logger.From(c.Request.Context()).Error("clearing login failures", "error", err)
+	}
+
+	if user.Disabled {
+		helpers.SendFailed(c, http.StatusForbidden, "account is disabled")
 		return
 	}
 
-	sign := jwt.New(jwt.GetSigningMethod("HS256"))
-	claims := sign.Claims.(jwt.MapClaims)
-	claims["user_id"] = user.UserId
-	claims["username"] = user.Username
+	// hashes from before BCRYPT_COST was raised are upgraded on the fly
+	ctl.rehash(c, user, userData.Password)
 
-	token, err := sign.SignedString([]byte("secret"))
+	needsCode, err := ctl.requiresTwoFactor(c, user)
 	if err != nil {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
+	if needsCode {
+		ctl.sendChallenge(c, user, MethodPassword)
+		return
+	}
+
+	ctl.completeLogin(c, user, MethodPassword, nil)
+}
+
+// completeLogin starts the session of a login by method that passed every
+// check and sends its tokens, extra is merged into the data
+func (ctl *Controller) completeLogin(c *gin.Context, user User, method string, extra gin.H) {
+	sessionId, err := ctl.startSession(c, user, method)
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
+	data, err := ctl.issueTokens(c.Request.Context(), user, sessionId)
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	data["id"] = user.UserId
+	data["profile_picture_url"] = user.ProfilePictureURL
+	data["username"] = user.Username
+	for k, v := range extra {
+		data[k] = v
+	}
+
+	if ctl.wantsCookies(c) {
+		if err := ctl.sendCookies(c, data); err != nil {
+			helpers.SendInternalServerError(c, err)
+			return
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"status": "success",
-		"data": gin.H{
-			"id":                  user.UserId,
-			"profile_picture_url": user.ProfilePictureURL,
-			"username":            userData.Username,
-			"token":               token,
-		},
+		"data":   data,
 	})
 }
 
-func Auth(c *gin.Context) {
+func (ctl *Controller) Auth(c *gin.Context) {
 	tokenString := c.Request.Header.Get("Authorization")
 	tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if jwt.GetSigningMethod("HS256") != token.Method {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+
+	// browsers in cookie session mode send the token as a cookie, which
+	// they'd attach to forged cross-site requests too
+	if cookie, err := c.Cookie(SessionCookie); tokenString == "" && err == nil && ctl.Cookies.Enabled {
+		if !checkCSRF(c) {
+			helpers.SendFailed(c, http.StatusForbidden, "missing or invalid csrf token")
+			return
 		}
+		tokenString = cookie
+	}
 
-		return []byte("secret"), nil
-	})
+	if strings.HasPrefix(tokenString, AccessTokenPrefix) {
+		ctl.authAccessToken(c, tokenString)
+		return
+	}
 
-	if token != nil && err == nil {
-		fmt.Println("token verified")
-	} else {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"message": "Not authorized",
-			"error":   err.Error(),
-		})
-		c.Abort()
+	// any key of the keyring is accepted, picked by the kid header
+	claims, err := ctl.Tokens.Verify(tokenString)
+	if err != nil {
+		sendUnauthorized(c, err.Error())
 		return
 	}
+	logger.From(c.Request.Context()).Debug("token verified")
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok && !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"message": "not authorized",
-			"error":   err.Error(),
-		})
-		c.Abort()
+	revoked, err := ctl.Revocations.IsRevoked(c.Request.Context(), claims.ID, claims.SessionId, claims.Subject, time.Unix(claims.IssuedAt, 0))
+	if err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+	if revoked {
+		sendUnauthorized(c, "token has been revoked")
 		return
 	}
 
-	c.Set("user", map[string]string{
-		"user_id":  claims["user_id"].(string),
-		"username": claims["username"].(string),
+	setPrincipal(c, &Principal{
+		UserId:    claims.Subject,
+		Username:  claims.Username,
+		Role:      Role(claims.Role),
+		SessionId: claims.SessionId,
+		TokenId:   claims.ID,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
 	})
 	c.Next()
 }
 
-func GetUsers(c *gin.Context) {
-	cursor, err := userColl.Find(context.Background(), bson.M{})
+func (ctl *Controller) GetUsers(c *gin.Context) {
+	users, err := ctl.Users.FindAll(c.Request.Context())
 	if err != nil {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
 
-	var users []User
-	if err = cursor.All(db.Ctx, &users); err != nil {
-		helpers.SendInternalServerError(c, err)
-		return
-	}
-
 	// delete password from struct by pass an empty string, for security purpose
 	for k := range users {
 		users[k].Password = ""
@@ -145,11 +234,15 @@ func GetUsers(c *gin.Context) {
 	})
 }
 
-func GetUserById(c *gin.Context) {
+func (ctl *Controller) GetUserById(c *gin.Context) {
 	id := c.Param("id")
-	var user User
 
-	if err := userColl.FindOne(context.Background(), bson.M{"user_id": id}).Decode(&user); err != nil {
+	user, err := ctl.Users.FindById(c.Request.Context(), id)
+	if err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusNotFound, "user not found")
+			return
+		}
 		helpers.SendInternalServerError(c, err)
 		return
 	}
@@ -163,63 +256,34 @@ func GetUserById(c *gin.Context) {
 	})
 }
 
-func AddUser(c *gin.Context) {
-	user, _ := c.Get("user")
+func (ctl *Controller) AddUser(c *gin.Context) {
+	user := MustPrincipal(c)
 	var userData User
 
 	if err := c.BindJSON(&userData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "failed",
-			"message": "can't bind struct",
-		})
-		c.Abort()
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
 		return
 	}
 
-	// check if there's user with the same username
-	var checkUsername User
-	err := userColl.FindOne(context.Background(), bson.M{"username": userData.Username}).Decode(&checkUsername)
+	_, err := CreateUser(c.Request.Context(), ctl.Users, ctl.Passwords, userData, user.UserId)
 	if err != nil {
-		if err != mongo.ErrNoDocuments {
-			helpers.SendInternalServerError(c, err)
+		var weak *WeakPasswordError
+		if errors.As(err, &weak) {
+			helpers.SendFailed(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err == ErrUsernameTaken {
+			helpers.SendFailed(c, http.StatusOK, fmt.Sprintf("Username %v sudah terpakai", userData.Username))
+			return
+		}
+		if err == ErrInvalidRole || err == ErrInvalidEmail {
+			helpers.SendFailed(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err == ErrEmailTaken {
+			helpers.SendFailed(c, http.StatusConflict, err.Error())
 			return
 		}
-	} else {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "failed",
-			"message": fmt.Sprintf("Username %v sudah terpakai", userData.Username),
-		})
-		c.Abort()
-		return
-	}
-
-	// create and uuid string to be stored at db
-	newUserId, err := helpers.CreateUUIDStr()
-	if err != nil {
-		helpers.SendInternalServerError(c, err)
-		return
-	}
-
-	hash, err := bcrypt.GenerateFromPassword([]byte(userData.Password), bcrypt.MinCost)
-	if err != nil {
-		helpers.SendInternalServerError(c, err)
-		return
-	}
-
-	newUser := bson.M{
-		"user_id":             newUserId,
-		"full_name":           userData.Fullname,
-		"username":            userData.Username,
-		"password":            string(hash),
-		"profile_picture_url": "", // default is empty
-		"phone_number":        userData.PhoneNumber,
-		"created_at":          time.Now(),
-		"updated_at":          time.Now(),
-		"updated_by":          user.(map[string]string)["user_id"],
-	}
-
-	_, err = userColl.InsertOne(context.Background(), newUser)
-	if err != nil {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
@@ -230,97 +294,152 @@ func AddUser(c *gin.Context) {
 	})
 }
 
-func EditUserById(c *gin.Context) {
-	user, _ := c.Get("user")
+func (ctl *Controller) EditUserById(c *gin.Context) {
+	user := MustPrincipal(c)
 	id := c.Param("id")
-	var userData User
+	var body EditUserRequest
 
-	if err := c.BindJSON(&userData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "failed",
-			"message": "can't bind struct",
-		})
-		c.Abort()
+	if err := c.BindJSON(&body); err != nil {
+		helpers.SendFailed(c, http.StatusBadRequest, "can't bind struct")
+		return
+	}
+
+	// passwords only change through ChangePassword (or the cli), $set-ing it
+	// here would store it in plaintext
+	if body.Password != "" {
+		helpers.SendFailed(c, http.StatusBadRequest, "password can't be edited here, use /password/change")
 		return
 	}
 
 	// add updated_at, updated_by
-	userData.UpdatedAt = time.Now()
-	userData.UpdatedBy = user.(map[string]string)["user_id"]
+	update := bson.M{
+		"updated_at": time.Now(),
+		"updated_by": user.UserId,
+	}
 
-	// update process
-	pByte, err := bson.Marshal(userData)
-	if err != nil {
-		helpers.SendInternalServerError(c, err)
-		return
+	if body.Fullname != nil {
+		update["full_name"] = *body.Fullname
+	}
+	if body.Username != nil {
+		if *body.Username == "" {
+			helpers.SendFailed(c, http.StatusBadRequest, "username can't be empty")
+			return
+		}
+		update["username"] = *body.Username
+	}
+	if body.Email != nil {
+		email, err := NormalizeEmail(*body.Email)
+		if err != nil {
+			helpers.SendFailed(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		update["email"] = email
+	}
+	if body.PhoneNumber != nil {
+		update["phone_number"] = *body.PhoneNumber
+	}
+	if body.Role != nil {
+		if !body.Role.Valid() {
+			helpers.SendFailed(c, http.StatusBadRequest, ErrInvalidRole.Error())
+			return
+		}
+		update["role"] = *body.Role
+	}
+	if body.Disabled != nil {
+		update["disabled"] = *body.Disabled
 	}
 
-	var update bson.M
-	err = bson.Unmarshal(pByte, &update)
+	ctx := c.Request.Context()
+	current, err := ctl.Users.FindById(ctx, id)
 	if err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusNotFound, "user not found")
+			return
+		}
 		helpers.SendInternalServerError(c, err)
 		return
 	}
 
-	_, err = userColl.UpdateOne(
-		context.Background(),
-		bson.M{"user_id": id},
-		bson.M{"$set": update},
-	)
-	if err != nil {
+	// update process
+	if err := ctl.Users.Update(ctx, id, update); err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusNotFound, "user not found")
+			return
+		}
+		if err == store.ErrDuplicate {
+			helpers.SendFailed(c, http.StatusConflict, "username or email already in use")
+			return
+		}
 		helpers.SendInternalServerError(c, err)
 		return
 	}
 
+	// a disabled account must not keep its open sessions either, and access
+	// tokens carry the role they were issued with
+	disabled := body.Disabled != nil && *body.Disabled
+	roleChanged := body.Role != nil && *body.Role != current.Role
+	if disabled || roleChanged {
+		if err := RevokeSessions(ctx, ctl.Revocations, ctl.RefreshTokens, ctl.AccessTokens, ctl.Sessions, id, ctl.Tokens.TTL); err != nil {
+			helpers.SendInternalServerError(c, err)
+			return
+		}
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
 		"status":  "success",
 		"message": "user edited successfully",
 	})
 }
 
-func DeleteUserById(c *gin.Context) {
+func (ctl *Controller) DeleteUserById(c *gin.Context) {
 	userId := c.Param("id")
 
 	// get user data
-	var deletedUserData User
-	if err := userColl.FindOne(context.Background(), bson.M{"user_id": userId}).Decode(&deletedUserData); err != nil {
+	deletedUserData, err := ctl.Users.FindById(c.Request.Context(), userId)
+	if err != nil {
+		if err == store.ErrNotFound {
+			helpers.SendFailed(c, http.StatusNotFound, "user not found")
+			return
+		}
 		helpers.SendInternalServerError(c, err)
 		return
 	}
 
-	// delete user profile picture in minio based on image_url (object name)
+	// delete user profile picture in object storage based on image_url (object name)
 	userProfilePicture := deletedUserData.ProfilePictureURL
 	if userProfilePicture != "" {
-		err := minio.MinioClient.RemoveObject(context.Background(), "fadel-blog", "profile/"+userProfilePicture, miniosdk.RemoveObjectOptions{})
+		err := ctl.Objects.Remove(c.Request.Context(), "profile/"+userProfilePicture)
 		if err != nil {
 			helpers.SendInternalServerError(c, err)
 			return
 		}
 	}
 
-	// delete user document in mongodb based on id
-	_, err := userColl.DeleteOne(context.Background(), bson.M{"user_id": userId})
+	// tokens issued to the account must die with it
+	err = RevokeSessions(c.Request.Context(), ctl.Revocations, ctl.RefreshTokens, ctl.AccessTokens, ctl.Sessions, userId, ctl.Tokens.TTL)
 	if err != nil {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
 
+	// delete user document in mongodb based on id
+	if err = ctl.Users.Delete(c.Request.Context(), userId); err != nil {
+		helpers.SendInternalServerError(c, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"message": "user deleted successfully",
 	})
 }
 
-func UpdateProfileImage(c *gin.Context) {
-	user, _ := c.Get("user")
+func (ctl *Controller) UpdateProfileImage(c *gin.Context) {
+	user := MustPrincipal(c)
 
 	fileHeader, err := c.FormFile("profile_image")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "failed",
-			"message": err.Error(),
-		})
-		c.Abort()
+		helpers.SendFailed(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -336,21 +455,23 @@ func UpdateProfileImage(c *gin.Context) {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
+	defer file.Close()
 
-	// upload to minio
-	objectName := fmt.Sprint(time.Now().UnixNano()) + filepath.Ext(fileHeader.Filename)
-	info, err := minio.MinioClient.PutObject(context.Background(), "fadel-blog", "profile/"+objectName, file, fileHeader.Size, miniosdk.PutObjectOptions{})
+	// upload to object storage
+	contentType, _ := helpers.ImageContentType(fileHeader.Filename)
+	objectName := fmt.Sprint(time.Now().UnixNano()) + strings.ToLower(filepath.Ext(fileHeader.Filename))
+	info, err := ctl.Objects.Put(c.Request.Context(), "profile/"+objectName, file, fileHeader.Size, contentType)
 	if err != nil {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
 
 	// 1. get updated user so we could get the old profile image
-	// 2. delete the old profile image from minio (if exists)
+	// 2. delete the old profile image from object storage (if exists)
 
 	// 1
-	var updatedUser User
-	if err := userColl.FindOne(context.Background(), bson.M{"user_id": user.(map[string]string)["user_id"]}).Decode(&updatedUser); err != nil {
+	updatedUser, err := ctl.Users.FindById(c.Request.Context(), user.UserId)
+	if err != nil {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
@@ -358,7 +479,7 @@ func UpdateProfileImage(c *gin.Context) {
 	// 2
 	userProfilePicture := updatedUser.ProfilePictureURL
 	if userProfilePicture != "" {
-		err := minio.MinioClient.RemoveObject(context.Background(), "fadel-blog", "profile/"+userProfilePicture, miniosdk.RemoveObjectOptions{})
+		err := ctl.Objects.Remove(c.Request.Context(), "profile/"+userProfilePicture)
 		if err != nil {
 			helpers.SendInternalServerError(c, err)
 			return
@@ -371,28 +492,16 @@ func UpdateProfileImage(c *gin.Context) {
 	// add updated_at, updated_by, and profile image url
 	updatedUserData.ProfilePictureURL = objectName
 	updatedUserData.UpdatedAt = time.Now()
-	updatedUserData.UpdatedBy = user.(map[string]string)["user_id"]
+	updatedUserData.UpdatedBy = user.UserId
 
 	// update process
-	pByte, err := bson.Marshal(updatedUserData)
-	if err != nil {
-		helpers.SendInternalServerError(c, err)
-		return
-	}
-
-	var update bson.M
-	err = bson.Unmarshal(pByte, &update)
+	update, err := store.ToSet(updatedUserData)
 	if err != nil {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
 
-	_, err = userColl.UpdateOne(
-		context.Background(),
-		bson.M{"user_id": user.(map[string]string)["user_id"]},
-		bson.M{"$set": update},
-	)
-	if err != nil {
+	if err = ctl.Users.Update(c.Request.Context(), user.UserId, update); err != nil {
 		helpers.SendInternalServerError(c, err)
 		return
 	}
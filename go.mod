@@ -1,10 +1,10 @@
 module fadel-blog-services
 
-go 1.19
+go 1.21
 
 require (
-	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/gin-gonic/gin v1.8.1
+	github.com/golang-jwt/jwt/v4 v4.5.2
 	github.com/joho/godotenv v1.4.0
 	github.com/minio/minio-go/v7 v7.0.35
 	github.com/nu7hatch/gouuid v0.0.0-20131221200532-179d4d0c4d8d